@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -19,10 +20,13 @@ import (
 	"github.com/tokenetes/tokenetes/pkg/config"
 	"github.com/tokenetes/tokenetes/pkg/configsync"
 	"github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
+	"github.com/tokenetes/tokenetes/pkg/health"
 	"github.com/tokenetes/tokenetes/pkg/keys"
 	"github.com/tokenetes/tokenetes/pkg/logging"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
 	"github.com/tokenetes/tokenetes/pkg/middlewares"
 	"github.com/tokenetes/tokenetes/pkg/service"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
 )
 
 const (
@@ -44,6 +48,17 @@ func main() {
 
 	mainLogger := logging.GetLogger("main")
 
+	shutdownTracer, err := tracing.InitTracer(ctx)
+	if err != nil {
+		mainLogger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
+	defer func() {
+		if err := shutdownTracer(context.Background()); err != nil {
+			mainLogger.Error("Failed to shut down tracing", zap.Error(err))
+		}
+	}()
+
 	x509SrcCtx, cancel := context.WithTimeout(context.Background(), SPIRE_SOURCE_TIMEOUT)
 
 	defer cancel()
@@ -60,13 +75,28 @@ func main() {
 		mainLogger.Fatal("Error getting application configuration.", zap.Error(err))
 	}
 
-	err = keys.Initialize()
+	err = keys.Initialize(keys.Config{
+		KeysDir:          appConfig.SigningKeysDir,
+		RotationInterval: appConfig.SigningKeyRotationInterval,
+		GracePeriod:      appConfig.SigningKeyGracePeriod,
+	})
 	if err != nil {
 		mainLogger.Fatal("Error initializing keys:", zap.Error(err))
 	}
 
-	httpClient := &http.Client{}
-	generationRules := v1alpha1.NewGenerationRulesImp(httpClient)
+	httpClient := tracing.NewHTTPClient()
+	generationRules := v1alpha1.NewGenerationRulesImp(httpClient, appConfig.LearningMode)
+
+	maxTokenLifetime := func() time.Duration {
+		tokenLifetime, err := generationRules.GetTokenLifetime()
+		if err != nil {
+			return 0
+		}
+
+		return tokenLifetime
+	}
+
+	go keys.Start(ctx, maxTokenLifetime, logging.GetLogger("keys"))
 
 	configSyncClient := configsync.NewClient(appConfig.TconfigdHost, appConfig.TconfigdSpiffeID, appConfig.MyNamespace, generationRules, x509Source, logging.GetLogger("config-sync"))
 
@@ -78,7 +108,27 @@ func main() {
 
 	apiLogger := logging.GetLogger("api-server")
 	apiService := service.NewService(generationRules, apiLogger)
-	apiHandler := handler.NewHandlers(apiService, apiLogger)
+	healthChecker := health.NewChecker()
+	healthChecker.AddReadinessCheck("initial-rules", func(context.Context) error {
+		if !configSyncClient.HasInitialRules() {
+			return errors.New("initial generation rules not received from tconfigd")
+		}
+
+		return nil
+	})
+	healthChecker.AddReadinessCheck("token-config", generationRules.CheckTokenConfig)
+	healthChecker.AddReadinessCheck("subject-token-handlers", generationRules.CheckSubjectTokenHandlers)
+	healthChecker.AddDependencyCheck("tconfigd", func(context.Context) error {
+		if !configSyncClient.IsConnected() {
+			return errors.New("not connected to tconfigd")
+		}
+
+		return nil
+	})
+	healthChecker.AddDependencyCheck("oidc-provider", generationRules.CheckOIDCProvider)
+	healthChecker.AddDependencyCheck("access-evaluation-api", generationRules.CheckAccessEvaluationAPI)
+
+	apiHandler := handler.NewHandlers(apiService, healthChecker, appConfig.PublicURLs, apiLogger)
 
 	go func() {
 		err := startHTTPServer(apiHandler, mainLogger)
@@ -88,12 +138,16 @@ func main() {
 	}()
 
 	traTGenAuthorizedSpiffeIDs := func() ([]spiffeid.ID, error) { return generationRules.GetTokenGenerationAuthorizedServiceIds() }
+	traTIntrospectionAuthorizedSpiffeIDs := func() ([]spiffeid.ID, error) {
+		return generationRules.GetTokenIntrospectionAuthorizedServiceIds()
+	}
 
 	go func() {
 		if err := startHTTPSServer(
 			apiHandler,
 			x509Source,
 			traTGenAuthorizedSpiffeIDs,
+			traTIntrospectionAuthorizedSpiffeIDs,
 			mainLogger,
 		); err != nil {
 			mainLogger.Fatal("HTTPS server exited with error", zap.Error(err))
@@ -108,6 +162,11 @@ func main() {
 func startHTTPServer(handlers *handler.Handlers, logger *zap.Logger) error {
 	router := mux.NewRouter()
 	router.HandleFunc("/generation-rules", handlers.GetGenerationRulesHandler).Methods("GET")
+	router.HandleFunc("/healthz", handlers.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", handlers.ReadinessHandler).Methods("GET")
+	router.HandleFunc(handler.JWKS_PATH, handlers.GetJWKSHandler).Methods("GET")
+	router.HandleFunc("/.well-known/oauth-authorization-server", handlers.GetAuthorizationServerMetadataHandler).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	srv := &http.Server{
 		Handler:      router,
@@ -127,10 +186,11 @@ func startHTTPServer(handlers *handler.Handlers, logger *zap.Logger) error {
 	return nil
 }
 
-func startHTTPSServer(handlers *handler.Handlers, x509Source *workloadapi.X509Source, traTGenAuthorizedSpiffeIDs func() ([]spiffeid.ID, error), logger *zap.Logger) error {
+func startHTTPSServer(handlers *handler.Handlers, x509Source *workloadapi.X509Source, traTGenAuthorizedSpiffeIDs func() ([]spiffeid.ID, error), traTIntrospectionAuthorizedSpiffeIDs func() ([]spiffeid.ID, error), logger *zap.Logger) error {
 	router := mux.NewRouter()
 
-	router.Handle("/token_endpoint", middlewares.AuthorizeSpiffeID(traTGenAuthorizedSpiffeIDs)(http.HandlerFunc(handlers.TokenEndpointHandler))).Methods("POST")
+	router.Handle(handler.TOKEN_ENDPOINT_PATH, tracing.NewHandler(middlewares.AuthorizeSpiffeID(traTGenAuthorizedSpiffeIDs)(http.HandlerFunc(handlers.TokenEndpointHandler)), "token_endpoint")).Methods("POST")
+	router.Handle(handler.INTROSPECTION_ENDPOINT_PATH, tracing.NewHandler(middlewares.AuthorizeSpiffeID(traTIntrospectionAuthorizedSpiffeIDs)(http.HandlerFunc(handlers.IntrospectionEndpointHandler)), "introspection_endpoint")).Methods("POST")
 
 	srv := &http.Server{
 		Handler:      router,
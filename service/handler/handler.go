@@ -3,29 +3,43 @@ package handler
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
 
 	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/config"
+	"github.com/tokenetes/tokenetes/pkg/health"
+	"github.com/tokenetes/tokenetes/pkg/middlewares"
 	"github.com/tokenetes/tokenetes/pkg/service"
 	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
 
 	"go.uber.org/zap"
 )
 
 type Handlers struct {
-	Service *service.Service
-	Logger  *zap.Logger
+	Service       *service.Service
+	HealthChecker *health.Checker
+	PublicURLs    config.PublicURLs
+	Logger        *zap.Logger
 }
 
-func NewHandlers(service *service.Service, logger *zap.Logger) *Handlers {
+func NewHandlers(service *service.Service, healthChecker *health.Checker, publicURLs config.PublicURLs, logger *zap.Logger) *Handlers {
 	return &Handlers{
-		Service: service,
-		Logger:  logger,
+		Service:       service,
+		HealthChecker: healthChecker,
+		PublicURLs:    publicURLs,
+		Logger:        logger,
 	}
 }
 
 const (
-	GRANT_TYPE = "urn:ietf:params:oauth:grant-type:token-exchange"
+	GRANT_TYPE                  = service.TOKEN_EXCHANGE_GRANT_TYPE
+	TOKEN_ENDPOINT_PATH         = "/token_endpoint"
+	INTROSPECTION_ENDPOINT_PATH = "/introspection_endpoint"
+	JWKS_PATH                   = "/.well-known/jwks.json"
 )
 
 func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request) {
@@ -33,22 +47,22 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := r.ParseForm(); err != nil {
 		h.Logger.Info("Failed to parse the txn-token request.", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: %v", tokeneteserrors.ErrInvalidRequest, err))
 
 		return
 	}
 
 	if r.FormValue("grant_type") != GRANT_TYPE {
 		h.Logger.Error("Invalid grant type.", zap.String("grant-type", r.FormValue("grant_type")))
-		http.Error(w, "Invalid grant type.", http.StatusUnprocessableEntity)
+		h.writeError(w, tokeneteserrors.ErrUnsupportedGrantType)
 
 		return
 	}
 
 	subjectTokenType := common.Str2TokenType[r.FormValue("subject_token_type")]
-	if subjectTokenType != common.OIDC_ID_TOKEN_TYPE && subjectTokenType != common.SELF_SIGNED_TOKEN_TYPE {
+	if subjectTokenType != common.OIDC_ID_TOKEN_TYPE && subjectTokenType != common.SELF_SIGNED_TOKEN_TYPE && subjectTokenType != common.TXN_TOKEN_TYPE {
 		h.Logger.Error("Invalid or unsupported subject token type.", zap.String("subject-token-type", string(subjectTokenType)))
-		http.Error(w, "Invalid or unsupported subject token type. Only OIDC ID and self-signed tokens are supported.", http.StatusUnprocessableEntity)
+		h.writeError(w, fmt.Errorf("%w: only OIDC ID, self-signed and txn tokens are supported as subject tokens", tokeneteserrors.ErrUnsupportedTokenType))
 
 		return
 	}
@@ -56,7 +70,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	subjectToken := r.FormValue("subject_token")
 	if subjectToken == "" {
 		h.Logger.Error("Subject token not provided.")
-		http.Error(w, "Subject token not provided.", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: subject token not provided", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
@@ -64,7 +78,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	audience := r.FormValue("audience")
 	if audience == "" {
 		h.Logger.Error("The audience value is not provided.")
-		http.Error(w, "The audience value is not provided.", http.StatusForbidden)
+		h.writeError(w, fmt.Errorf("%w: audience not provided", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
@@ -72,7 +86,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	requestedTokenType := common.Str2TokenType[r.FormValue("requested_token_type")]
 	if requestedTokenType != common.TXN_TOKEN_TYPE {
 		h.Logger.Error("Invalid requested token type.", zap.String("requested-token-type", string(requestedTokenType)))
-		http.Error(w, "Invalid requested token type.", http.StatusUnprocessableEntity)
+		h.writeError(w, fmt.Errorf("%w: requested token type must be %s", tokeneteserrors.ErrInvalidRequest, common.TXN_TOKEN_TYPE))
 
 		return
 	}
@@ -82,7 +96,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	requestDetailsJSON, err := base64.RawURLEncoding.DecodeString(requestDetailsEncoded)
 	if err != nil {
 		h.Logger.Error("Failed to base64url decode the request details", zap.Error(err))
-		http.Error(w, "Invalid request details encoding", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: invalid request details encoding", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
@@ -91,14 +105,14 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := json.Unmarshal(requestDetailsJSON, &requestDetails); err != nil {
 		h.Logger.Error("Failed to unmarshal request details from the request", zap.Error(err))
-		http.Error(w, "Invalid request details format", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: invalid request details format", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
 
 	if err := requestDetails.Validate(); err != nil {
 		h.Logger.Error("Invalid request details:", zap.Error(err))
-		http.Error(w, "Invalid request details: "+err.Error(), http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: %v", tokeneteserrors.ErrInvalidRequestDetails, err))
 
 		return
 	}
@@ -108,7 +122,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	requestContextJSON, err := base64.RawURLEncoding.DecodeString(requestContextEncoded)
 	if err != nil {
 		h.Logger.Error("Failed to base64url decode the request context", zap.Error(err))
-		http.Error(w, "Invalid request context encoding", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: invalid request context encoding", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
@@ -117,7 +131,7 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := json.Unmarshal(requestContextJSON, &requestContext); err != nil {
 		h.Logger.Error("Failed to unmarshal request context from the request", zap.Error(err))
-		http.Error(w, "Invalid request context format", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: invalid request context format", tokeneteserrors.ErrInvalidRequest))
 
 		return
 	}
@@ -129,25 +143,19 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 		SubjectTokenType:   subjectTokenType,
 		RequestDetails:     requestDetails,
 		RequestContext:     requestContext,
+		Requester:          requester(r),
 	}
 
 	txnTokenResponse, err := h.Service.GenerateTxnToken(r.Context(), &txnTokenRequest)
 	if err != nil {
-		h.Logger.Error("Error generating txn token.", zap.Error(err))
-
-		switch err {
-		case tokeneteserrors.ErrParsingSubjectToken, tokeneteserrors.ErrInvalidSubjectTokenClaims, tokeneteserrors.ErrUnsupportedTokenType, tokeneteserrors.ErrSubjectFieldNotFound:
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		case tokeneteserrors.ErrAccessDenied:
-			http.Error(w, err.Error(), http.StatusForbidden)
-		default:
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
+		h.Logger.Error("Error generating txn token.", zap.Error(err), zap.String("trace-id", tracing.TraceID(r.Context())))
+		h.writeError(w, err)
 
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 
 	if err := json.NewEncoder(w).Encode(txnTokenResponse); err != nil {
 		h.Logger.Error("Failed to encode the token response.", zap.Error(err))
@@ -158,6 +166,126 @@ func (h *Handlers) TokenEndpointHandler(w http.ResponseWriter, r *http.Request)
 	h.Logger.Info("Txn-Token request processed successfully.")
 }
 
+func (h *Handlers) IntrospectionEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.Logger.Info("Failed to parse the introspection request.", zap.Error(err))
+		h.writeError(w, fmt.Errorf("%w: %v", tokeneteserrors.ErrInvalidRequest, err))
+
+		return
+	}
+
+	token := r.FormValue("token")
+	if token == "" {
+		h.Logger.Error("Token not provided for introspection.")
+		h.writeError(w, fmt.Errorf("%w: token not provided", tokeneteserrors.ErrInvalidRequest))
+
+		return
+	}
+
+	introspectionResponse := h.Service.IntrospectTxnToken(r.Context(), token)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := json.NewEncoder(w).Encode(introspectionResponse); err != nil {
+		h.Logger.Error("Failed to encode the introspection response.", zap.Error(err))
+	}
+}
+
+type errorResponse struct {
+	Error            tokeneteserrors.ErrorCode `json:"error"`
+	ErrorDescription string                    `json:"error_description,omitempty"`
+}
+
+func (h *Handlers) writeError(w http.ResponseWriter, err error) {
+	errorCode, errorDescription := tokeneteserrors.Classify(err)
+
+	// The response only carries the description of the classified error; the full error is kept in the logs.
+	h.Logger.Warn("Request failed.", zap.String("error-code", string(errorCode)), zap.Error(err))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(errorCode.HTTPStatus())
+
+	if err := json.NewEncoder(w).Encode(errorResponse{Error: errorCode, ErrorDescription: errorDescription}); err != nil {
+		h.Logger.Error("Failed to encode the error response.", zap.Error(err))
+	}
+}
+
+func (h *Handlers) GetJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(h.Service.GetJwks()); err != nil {
+		h.Logger.Error("Failed to encode the JWKS.", zap.Error(err))
+	}
+}
+
+// GetAuthorizationServerMetadataHandler serves the RFC 8414 metadata. The endpoint URLs are built from the
+// configured public URLs, by default the issuer's host over https and its hostname over http, and never from the
+// request.
+func (h *Handlers) GetAuthorizationServerMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	issuerURL, err := h.Service.IssuerURL()
+	if err != nil {
+		h.Logger.Error("Failed to get authorization server metadata.", zap.Error(err))
+		http.Error(w, "Authorization server metadata not available", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	httpsURL := h.PublicURLs.HTTPS
+	if httpsURL == nil {
+		httpsURL = &url.URL{Scheme: "https", Host: issuerURL.Host}
+	}
+
+	httpURL := h.PublicURLs.HTTP
+	if httpURL == nil {
+		httpURL = &url.URL{Scheme: "http", Host: issuerURL.Hostname()}
+	}
+
+	metadata, err := h.Service.GetAuthorizationServerMetadata(
+		httpsURL.JoinPath(TOKEN_ENDPOINT_PATH).String(),
+		httpsURL.JoinPath(INTROSPECTION_ENDPOINT_PATH).String(),
+		httpURL.JoinPath(JWKS_PATH).String(),
+	)
+	if err != nil {
+		h.Logger.Error("Failed to get authorization server metadata.", zap.Error(err))
+		http.Error(w, "Authorization server metadata not available", http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(metadata); err != nil {
+		h.Logger.Error("Failed to encode the authorization server metadata.", zap.Error(err))
+	}
+}
+
+func (h *Handlers) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// ReadinessHandler reports whether tokenetes can issue tokens. The per-dependency status of tconfigd, the OIDC
+// provider and the access evaluation api is included with ?verbose=true.
+func (h *Handlers) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	verbose := r.URL.Query().Get("verbose") == "true"
+
+	report := h.HealthChecker.CheckReadiness(r.Context(), verbose)
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		h.Logger.Error("Failed to encode the readiness report.", zap.Error(err))
+	}
+}
+
 func (h *Handlers) GetGenerationRulesHandler(w http.ResponseWriter, r *http.Request) {
 	generationRules, err := h.Service.GetGenerationRules()
 	if err != nil {
@@ -170,3 +298,18 @@ func (h *Handlers) GetGenerationRulesHandler(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusOK)
 	w.Write(generationRules)
 }
+
+// requester returns the workload SPIFFE ID authenticated by the mTLS middleware and the IP address of the peer.
+func requester(r *http.Request) common.Requester {
+	var requester common.Requester
+
+	if spiffeID, ok := middlewares.SpiffeIDFromContext(r.Context()); ok {
+		requester.WorkloadID = spiffeID
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		requester.IP = ip
+	}
+
+	return requester
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/config"
+	v1alpha1 "github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
+	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/service"
+	"github.com/tokenetes/tokenetes/pkg/subjecttokenhandler"
+	"go.uber.org/zap"
+)
+
+const testAudience = "https://api.example"
+
+// newTestHandlers returns handlers issuing tokens for unverified self-signed subject tokens under the trat rule.
+func newTestHandlers(t *testing.T, rule v1alpha1.TraTGenerationRule) *Handlers {
+	t.Helper()
+
+	if err := keys.Initialize(keys.Config{}); err != nil {
+		t.Fatalf("keys.Initialize() error = %v", err)
+	}
+
+	generationRules := v1alpha1.NewGenerationRulesImp(nil, false)
+
+	if err := generationRules.UpdateTokenetesConfigRule(v1alpha1.TokenetesConfigGenerationRule{
+		Token:         &v1alpha1.TokenetesConfigToken{Issuer: "https://tokenetes.example", Audience: testAudience, LifeTime: "5m"},
+		SubjectTokens: &subjecttokenhandler.SubjectTokens{SelfSigned: &subjecttokenhandler.SelfSignedToken{}},
+	}); err != nil {
+		t.Fatalf("UpdateTokenetesConfigRule() error = %v", err)
+	}
+
+	if err := generationRules.UpsertTraTRule(rule); err != nil {
+		t.Fatalf("UpsertTraTRule() error = %v", err)
+	}
+
+	return NewHandlers(service.NewService(generationRules, zap.NewNop()), nil, config.PublicURLs{}, zap.NewNop())
+}
+
+// newTokenRequest returns a txn-token request for the request details.
+func newTokenRequest(t *testing.T, requestDetails common.RequestDetails) *http.Request {
+	t.Helper()
+
+	subjectToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "alice"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to create subject token: %v", err)
+	}
+
+	requestDetailsJSON, err := json.Marshal(requestDetails)
+	if err != nil {
+		t.Fatalf("failed to marshal request details: %v", err)
+	}
+
+	form := url.Values{
+		"grant_type":           {GRANT_TYPE},
+		"subject_token_type":   {string(common.SELF_SIGNED_TOKEN_TYPE)},
+		"subject_token":        {subjectToken},
+		"audience":             {testAudience},
+		"requested_token_type": {string(common.TXN_TOKEN_TYPE)},
+		"request_details":      {base64.RawURLEncoding.EncodeToString(requestDetailsJSON)},
+		"request_context":      {base64.RawURLEncoding.EncodeToString([]byte("{}"))},
+	}
+
+	request := httptest.NewRequest(http.MethodPost, TOKEN_ENDPOINT_PATH, strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return request
+}
+
+func TestTokenEndpointHandlerMissingAzdField(t *testing.T) {
+	rule := v1alpha1.TraTGenerationRule{
+		TraTName: "transfer",
+		Path:     "/transfers",
+		Method:   common.Post,
+		Purp:     "transfer",
+		AzdMapping: v1alpha1.AzdMapping{
+			"transfer_amount": {Required: true, Value: "${body.amount}"},
+			"currency":        {Value: "${body.currency}"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		// wantBody is the error response; successful responses are only checked for a token.
+		wantBody string
+	}{
+		{
+			name:       "required field present",
+			body:       `{"amount": 250}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing required field is named in the error description",
+			body:       `{"currency": "EUR"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"invalid_request","error_description":"required azd field missing from the request: body.amount"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers := newTestHandlers(t, rule)
+
+			recorder := httptest.NewRecorder()
+			handlers.TokenEndpointHandler(recorder, newTokenRequest(t, common.RequestDetails{
+				Path:   "/transfers",
+				Method: common.Post,
+				Body:   json.RawMessage(tt.body),
+			}))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", recorder.Code, tt.wantStatus, recorder.Body)
+			}
+
+			if tt.wantBody == "" {
+				var tokenResponse service.TokenResponse
+				if err := json.Unmarshal(recorder.Body.Bytes(), &tokenResponse); err != nil || tokenResponse.AccessToken == "" {
+					t.Errorf("body = %s, want a token response", recorder.Body)
+				}
+
+				return
+			}
+
+			if body := strings.TrimSpace(recorder.Body.String()); body != tt.wantBody {
+				t.Errorf("body = %s, want %s", body, tt.wantBody)
+			}
+		})
+	}
+}
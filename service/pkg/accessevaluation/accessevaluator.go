@@ -2,22 +2,51 @@ package accessevaluation
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/tidwall/gjson"
 	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
+	"github.com/tokenetes/tokenetes/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const (
+	// ACCESS_EVALUATION_FORMAT_GENERIC posts the resolved access evaluation mapping to the endpoint as it is and
+	// reads the decision, {"decision": bool} by default. It is the default.
+	ACCESS_EVALUATION_FORMAT_GENERIC = "generic"
+	// ACCESS_EVALUATION_FORMAT_AUTHZEN follows the OpenID AuthZEN Authorization API. The endpoint is the base URL of
+	// the PDP.
+	ACCESS_EVALUATION_FORMAT_AUTHZEN = "authzen"
+	// ACCESS_EVALUATION_FORMAT_OPA queries the data API of Open Policy Agent for the decision of Package. The
+	// endpoint is the base URL of OPA.
+	ACCESS_EVALUATION_FORMAT_OPA = "opa"
+)
+
 type AccessEvaluationAPI struct {
 	Endpoint               string         `json:"endpoint"`
 	Authentication         Authentication `json:"authentication"`
 	EnableAccessEvaluation bool           `json:"enableAccessEvaluation"`
+	Format                 string         `json:"format,omitempty"`
+	Package                string         `json:"package,omitempty"`
+	ResultPaths            *ResultPaths   `json:"resultPaths,omitempty"`
+	DecisionCache          *DecisionCache `json:"decisionCache,omitempty"`
+	// Timeout bounds each attempt of an access evaluation request. It is 5s by default.
+	Timeout        string          `json:"timeout,omitempty"`
+	Retry          *Retry          `json:"retry,omitempty"`
+	CircuitBreaker *CircuitBreaker `json:"circuitBreaker,omitempty"`
 }
 
 type Authentication struct {
@@ -31,15 +60,16 @@ type Token struct {
 
 type AccessEvaluator struct {
 	accessEvaluationAPI AccessEvaluationAPI
+	adapter             Adapter
 	resolvedTokenValue  string
+	decisionCache       *decisionCache
+	timeout             time.Duration
+	retryPolicy         retryPolicy
+	circuitBreaker      *circuitBreaker
 	httpClient          *http.Client
 	logger              *zap.Logger
 }
 
-type accessEvaluationResponse struct {
-	Decision bool `json:"decision"`
-}
-
 func NewAccessEvaluator(accessEvaluationAPI AccessEvaluationAPI, httpClient *http.Client, logger *zap.Logger) *AccessEvaluator {
 	accessEvaluator := &AccessEvaluator{
 		accessEvaluationAPI: accessEvaluationAPI,
@@ -61,14 +91,119 @@ func NewAccessEvaluator(accessEvaluationAPI AccessEvaluationAPI, httpClient *htt
 		accessEvaluator.resolvedTokenValue = tokenValue
 	}
 
+	accessEvaluator.timeout = DEFAULT_ACCESS_EVALUATION_TIMEOUT
+
+	if accessEvaluationAPI.Timeout != "" {
+		if timeout, err := time.ParseDuration(accessEvaluationAPI.Timeout); err != nil || timeout <= 0 {
+			logger.Error("Invalid access evaluation timeout; using the default timeout.", zap.String("timeout", accessEvaluationAPI.Timeout), zap.Error(err))
+		} else {
+			accessEvaluator.timeout = timeout
+		}
+	}
+
+	retryPolicy, err := newRetryPolicy(accessEvaluationAPI.Retry)
+	if err != nil {
+		logger.Error("Invalid access evaluation retry configuration; requests will not be retried.", zap.Error(err))
+
+		retryPolicy, _ = newRetryPolicy(nil)
+	}
+
+	accessEvaluator.retryPolicy = retryPolicy
+
+	if accessEvaluationAPI.CircuitBreaker != nil && accessEvaluationAPI.CircuitBreaker.FailureThreshold > 0 {
+		circuitBreaker, err := newCircuitBreaker(*accessEvaluationAPI.CircuitBreaker)
+		if err != nil {
+			logger.Error("Invalid circuit breaker configuration; the circuit breaker is disabled.", zap.Error(err))
+		} else {
+			accessEvaluator.circuitBreaker = circuitBreaker
+		}
+	}
+
+	adapter, err := newAdapter(accessEvaluationAPI, accessEvaluator.post, logger)
+	if err != nil {
+		logger.Error("Invalid access evaluation format; access evaluations will fail.", zap.Error(err))
+	} else {
+		accessEvaluator.adapter = adapter
+	}
+
+	if accessEvaluationAPI.DecisionCache != nil {
+		decisionCache, err := newDecisionCache(*accessEvaluationAPI.DecisionCache)
+		if err != nil {
+			logger.Error("Invalid decision cache configuration; decisions will not be cached.", zap.Error(err))
+		} else {
+			accessEvaluator.decisionCache = decisionCache
+		}
+	}
+
 	return accessEvaluator
 }
 
-func (ae *AccessEvaluator) Evaluate(requestMapping map[string]interface{}, subject_token interface{}, requestDetails common.RequestDetails, requestContext map[string]interface{}, pathParameter map[string]string) (bool, error) {
+func (ae *AccessEvaluator) Evaluate(ctx context.Context, requestMapping map[string]interface{}, subject_token interface{}, requestDetails common.RequestDetails, requestContext map[string]interface{}, pathParameter map[string]interface{}) (bool, error) {
 	if !ae.IsAccessEvaluationEnabled() {
 		return true, nil
 	}
 
+	if ae.adapter == nil {
+		return false, fmt.Errorf("access evaluation api format %q is not supported", ae.accessEvaluationAPI.Format)
+	}
+
+	inputData := NewInput(subject_token, requestDetails, requestContext, pathParameter)
+
+	requestData, err := resolveJSONPaths(inputData, requestMapping)
+	if err != nil {
+		return false, fmt.Errorf("%w: error resolving access request mapping: %v", tokeneteserrors.ErrInvalidRequestDetails, err)
+	}
+
+	var cacheKey string
+
+	if ae.decisionCache != nil {
+		cacheKey, err = utils.CanonicalizeJSON(requestData)
+		if err != nil {
+			return false, fmt.Errorf("error canonicalizing access evaluation request: %w", err)
+		}
+
+		if decision, ok := ae.decisionCache.get(cacheKey); ok {
+			metrics.ObserveAccessEvaluationCache(true)
+
+			return decision, nil
+		}
+
+		metrics.ObserveAccessEvaluationCache(false)
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "AccessEvaluator.Evaluate", trace.WithAttributes(
+		attribute.String("tokenetes.access_evaluation.endpoint", ae.accessEvaluationAPI.Endpoint),
+		attribute.String("tokenetes.access_evaluation.format", ae.format()),
+	))
+
+	start := time.Now()
+
+	decision, header, err := ae.adapter.Evaluate(ctx, requestData)
+
+	span.SetAttributes(attribute.Bool("tokenetes.access_evaluation.decision", decision))
+	tracing.EndSpan(span, err)
+
+	if err != nil {
+		metrics.ObserveAccessEvaluation(metrics.DECISION_ERROR, time.Since(start))
+
+		return false, err
+	}
+
+	if decision {
+		metrics.ObserveAccessEvaluation(metrics.DECISION_PERMIT, time.Since(start))
+	} else {
+		metrics.ObserveAccessEvaluation(metrics.DECISION_DENY, time.Since(start))
+	}
+
+	if ae.decisionCache != nil {
+		ae.decisionCache.set(cacheKey, decision, header)
+	}
+
+	return decision, nil
+}
+
+// NewInput returns the input document that access evaluation mappings and local policies are evaluated over.
+func NewInput(subject_token interface{}, requestDetails common.RequestDetails, requestContext map[string]interface{}, pathParameter map[string]interface{}) map[string]interface{} {
 	inputData := map[string]interface{}{
 		"body":            requestDetails.Body,
 		"headers":         requestDetails.Headers,
@@ -82,19 +217,69 @@ func (ae *AccessEvaluator) Evaluate(requestMapping map[string]interface{}, subje
 		inputData[key] = value
 	}
 
-	requestData, err := resolveJSONPaths(inputData, requestMapping)
-	if err != nil {
-		return false, fmt.Errorf("error resolving access request mapping: %w", err)
+	return inputData
+}
+
+func (ae *AccessEvaluator) format() string {
+	if ae.accessEvaluationAPI.Format == "" {
+		return ACCESS_EVALUATION_FORMAT_GENERIC
 	}
 
+	return ae.accessEvaluationAPI.Format
+}
+
+// post sends requestData to the access evaluation api, decodes the response into response and returns the
+// response header. Errors wrap tokeneteserrors.ErrAccessEvaluationUnavailable when the api could not be reached,
+// after the configured retries, or when the circuit breaker is open.
+func (ae *AccessEvaluator) post(ctx context.Context, endpoint string, requestData interface{}, response interface{}) (http.Header, error) {
 	jsonData, err := json.Marshal(requestData)
 	if err != nil {
-		return false, fmt.Errorf("error marshalling access evaluation request: %w", err)
+		return nil, fmt.Errorf("error marshalling access evaluation request: %w", err)
+	}
+
+	if ae.circuitBreaker != nil && !ae.circuitBreaker.allow() {
+		return nil, fmt.Errorf("%w: circuit breaker is open", tokeneteserrors.ErrAccessEvaluationUnavailable)
+	}
+
+	var header http.Header
+
+	for attempt := 1; ; attempt++ {
+		header, err = ae.postAttempt(ctx, endpoint, jsonData, response)
+		if err == nil || !errors.Is(err, tokeneteserrors.ErrAccessEvaluationUnavailable) || attempt >= ae.retryPolicy.maxAttempts {
+			break
+		}
+
+		ae.logger.Warn("Access evaluation request failed; retrying.", zap.Int("attempt", attempt), zap.Error(err))
+
+		if !ae.retryPolicy.wait(ctx, attempt) {
+			break
+		}
+	}
+
+	// A request abandoned by the caller says nothing about the access evaluation api, so it is neither retried,
+	// nor recorded by the circuit breaker, nor treated as the api being unavailable.
+	if ctx.Err() != nil {
+		if ae.circuitBreaker != nil {
+			ae.circuitBreaker.release()
+		}
+
+		return nil, fmt.Errorf("access evaluation request cancelled: %w", ctx.Err())
+	}
+
+	if ae.circuitBreaker != nil {
+		ae.circuitBreaker.record(!errors.Is(err, tokeneteserrors.ErrAccessEvaluationUnavailable))
 	}
 
-	req, err := http.NewRequest(http.MethodPost, ae.accessEvaluationAPI.Endpoint, bytes.NewBuffer(jsonData))
+	return header, err
+}
+
+func (ae *AccessEvaluator) postAttempt(ctx context.Context, endpoint string, jsonData []byte, response interface{}) (http.Header, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, ae.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return false, fmt.Errorf("error constructing access evaluation request: %w", err)
+		return nil, fmt.Errorf("error constructing access evaluation request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -105,27 +290,63 @@ func (ae *AccessEvaluator) Evaluate(requestMapping map[string]interface{}, subje
 
 	resp, err := ae.httpClient.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("error making access evaluation request: %w", err)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("access evaluation request cancelled: %w", ctx.Err())
+		}
+
+		return nil, fmt.Errorf("%w: error making access evaluation request: %v", tokeneteserrors.ErrAccessEvaluationUnavailable, err)
 	}
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: access evaluation api returned status %d", tokeneteserrors.ErrAccessEvaluationUnavailable, resp.StatusCode)
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return false, fmt.Errorf("error reading error response body from access evaluation api: %w", err)
+			return nil, fmt.Errorf("error reading error response body from access evaluation api: %w", err)
 		}
 
-		return false, fmt.Errorf("access evaluation api request failed with non-ok status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("access evaluation api request failed with non-ok status %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
-	var response accessEvaluationResponse
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("access evaluation request cancelled: %w", ctx.Err())
+		}
+
+		if attemptCtx.Err() != nil {
+			return nil, fmt.Errorf("%w: error reading response from the access evaluation api: %v", tokeneteserrors.ErrAccessEvaluationUnavailable, err)
+		}
 
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return false, fmt.Errorf("error decoding response from the access evaluation api: %w", err)
+		return nil, fmt.Errorf("error decoding response from the access evaluation api: %w", err)
 	}
 
-	return response.Decision, nil
+	return resp.Header, nil
+}
+
+// CheckEndpoint checks that the access evaluation api is reachable. Any http response counts, since the api
+// may reject a request without a valid evaluation body.
+func (ae *AccessEvaluator) CheckEndpoint(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ae.accessEvaluationAPI.Endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ae.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("access evaluation api returned status %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
 func (ae *AccessEvaluator) IsAccessEvaluationEnabled() bool {
@@ -167,6 +388,19 @@ func resolveJSONPaths(inputData map[string]interface{}, mapping interface{}) (in
 		}
 
 		return resolvedMap, nil
+	case []interface{}:
+		resolvedSlice := make([]interface{}, 0, len(v))
+
+		for i, val := range v {
+			resolvedValue, err := resolveJSONPaths(inputData, val)
+			if err != nil {
+				return nil, fmt.Errorf("error resolving value at index %d: %v", i, err)
+			}
+
+			resolvedSlice = append(resolvedSlice, resolvedValue)
+		}
+
+		return resolvedSlice, nil
 	default:
 		return v, nil
 	}
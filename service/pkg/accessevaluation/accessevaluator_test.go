@@ -0,0 +1,182 @@
+package accessevaluation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"go.uber.org/zap"
+)
+
+func TestAccessEvaluatorPost(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []int
+		retry          *Retry
+		circuitBreaker *CircuitBreaker
+		// calls is the number of posts; the last one is checked.
+		calls int
+		// halfOpen lets the first post through the circuit breaker as its half-open probe.
+		halfOpen     bool
+		cancelled    bool
+		wantErr      bool
+		wantErrIs    error
+		wantAttempts int
+		wantState    circuitState
+	}{
+		{
+			name:         "succeeds on the first attempt",
+			statuses:     []int{http.StatusOK},
+			retry:        &Retry{MaxAttempts: 3, InitialBackoff: "1ms"},
+			calls:        1,
+			wantAttempts: 1,
+		},
+		{
+			name:         "retries while the api is unavailable",
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			retry:        &Retry{MaxAttempts: 3, InitialBackoff: "1ms"},
+			calls:        1,
+			wantAttempts: 3,
+		},
+		{
+			name:         "gives up after the max attempts",
+			statuses:     []int{http.StatusBadGateway},
+			retry:        &Retry{MaxAttempts: 3, InitialBackoff: "1ms"},
+			calls:        1,
+			wantErr:      true,
+			wantErrIs:    tokeneteserrors.ErrAccessEvaluationUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "client errors are not retried",
+			statuses:     []int{http.StatusBadRequest},
+			retry:        &Retry{MaxAttempts: 3, InitialBackoff: "1ms"},
+			calls:        1,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name:           "open circuit breaker stops calls to the api",
+			statuses:       []int{http.StatusServiceUnavailable},
+			circuitBreaker: &CircuitBreaker{FailureThreshold: 2, OpenDuration: "1m"},
+			calls:          3,
+			wantErr:        true,
+			wantErrIs:      tokeneteserrors.ErrAccessEvaluationUnavailable,
+			wantAttempts:   2,
+			wantState:      circuitOpen,
+		},
+		{
+			name:           "client errors do not open the circuit breaker",
+			statuses:       []int{http.StatusBadRequest},
+			circuitBreaker: &CircuitBreaker{FailureThreshold: 1, OpenDuration: "1m"},
+			calls:          2,
+			wantErr:        true,
+			wantAttempts:   2,
+			wantState:      circuitClosed,
+		},
+		{
+			name:           "cancelled requests are neither retried nor recorded",
+			statuses:       []int{http.StatusOK},
+			retry:          &Retry{MaxAttempts: 3, InitialBackoff: "1ms"},
+			circuitBreaker: &CircuitBreaker{FailureThreshold: 1, OpenDuration: "1m"},
+			calls:          2,
+			cancelled:      true,
+			wantErr:        true,
+			wantErrIs:      context.Canceled,
+			wantAttempts:   0,
+			wantState:      circuitClosed,
+		},
+		{
+			name:           "cancelled half-open probes reopen the circuit breaker without a failure",
+			statuses:       []int{http.StatusOK},
+			circuitBreaker: &CircuitBreaker{FailureThreshold: 1, OpenDuration: "1m"},
+			calls:          1,
+			halfOpen:       true,
+			cancelled:      true,
+			wantErr:        true,
+			wantErrIs:      context.Canceled,
+			wantAttempts:   0,
+			wantState:      circuitOpen,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := tt.statuses[min(attempts, len(tt.statuses)-1)]
+				attempts++
+
+				w.WriteHeader(status)
+				w.Write([]byte(`{"decision": true}`))
+			}))
+			defer server.Close()
+
+			accessEvaluator := NewAccessEvaluator(AccessEvaluationAPI{
+				Endpoint:               server.URL,
+				EnableAccessEvaluation: true,
+				Retry:                  tt.retry,
+				CircuitBreaker:         tt.circuitBreaker,
+			}, server.Client(), zap.NewNop())
+
+			if tt.halfOpen {
+				accessEvaluator.circuitBreaker.state = circuitOpen
+				accessEvaluator.circuitBreaker.consecutiveFailures = tt.circuitBreaker.FailureThreshold
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.cancelled {
+				cancel()
+			}
+
+			var err error
+
+			for i := 0; i < tt.calls; i++ {
+				var response json.RawMessage
+
+				_, err = accessEvaluator.post(ctx, server.URL, map[string]interface{}{}, &response)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("post() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			// Only unavailability is retried and recorded by the circuit breaker.
+			if tt.wantErr && errors.Is(err, tokeneteserrors.ErrAccessEvaluationUnavailable) != errors.Is(tt.wantErrIs, tokeneteserrors.ErrAccessEvaluationUnavailable) {
+				t.Errorf("post() error = %v, want %v", err, tt.wantErrIs)
+			}
+
+			if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("post() error = %v, want %v", err, tt.wantErrIs)
+			}
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+
+			if accessEvaluator.circuitBreaker != nil && accessEvaluator.circuitBreaker.state != tt.wantState {
+				t.Errorf("circuit breaker state = %v, want %v", accessEvaluator.circuitBreaker.state, tt.wantState)
+			}
+
+			// The next evaluation probes the api again and closes the circuit breaker once the api answers.
+			if tt.halfOpen {
+				var response json.RawMessage
+
+				if _, err := accessEvaluator.post(context.Background(), server.URL, map[string]interface{}{}, &response); err != nil {
+					t.Errorf("post() after the cancelled probe error = %v", err)
+				}
+
+				if accessEvaluator.circuitBreaker.state != circuitClosed {
+					t.Errorf("circuit breaker state after the next probe = %v, want %v", accessEvaluator.circuitBreaker.state, circuitClosed)
+				}
+			}
+		})
+	}
+}
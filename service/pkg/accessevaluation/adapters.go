@@ -0,0 +1,171 @@
+package accessevaluation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+// Adapter translates resolved access evaluation requests to the request and response format of a PDP.
+type Adapter interface {
+	// Evaluate returns the decision for requestData, the resolved access evaluation mapping of a rule, and the
+	// header of the PDP response.
+	Evaluate(ctx context.Context, requestData interface{}) (bool, http.Header, error)
+}
+
+// ResultPaths are the gjson paths of the decision and of the reasons for it in a PDP response. The reasons are
+// logged when access is denied.
+type ResultPaths struct {
+	Decision string `json:"decision,omitempty"`
+	Reasons  string `json:"reasons,omitempty"`
+}
+
+// postFunc sends a request to the PDP with the timeout, retries and circuit breaker of the access evaluator.
+type postFunc func(ctx context.Context, endpoint string, requestData interface{}, response interface{}) (http.Header, error)
+
+func newAdapter(accessEvaluationAPI AccessEvaluationAPI, post postFunc, logger *zap.Logger) (Adapter, error) {
+	var resultPaths ResultPaths
+
+	if accessEvaluationAPI.ResultPaths != nil {
+		resultPaths = *accessEvaluationAPI.ResultPaths
+	}
+
+	switch accessEvaluationAPI.Format {
+	case "", ACCESS_EVALUATION_FORMAT_GENERIC:
+		return &genericAdapter{
+			endpoint:    accessEvaluationAPI.Endpoint,
+			resultPaths: resultPaths.withDefaults(ResultPaths{Decision: "decision", Reasons: "context"}),
+			post:        post,
+			logger:      logger,
+		}, nil
+	case ACCESS_EVALUATION_FORMAT_AUTHZEN:
+		return &authZENAdapter{
+			endpoint:    strings.TrimSuffix(accessEvaluationAPI.Endpoint, "/"),
+			resultPaths: resultPaths.withDefaults(ResultPaths{Decision: "decision", Reasons: "context"}),
+			post:        post,
+			logger:      logger,
+		}, nil
+	case ACCESS_EVALUATION_FORMAT_OPA:
+		if accessEvaluationAPI.Package == "" {
+			return nil, fmt.Errorf("the %s format requires a package", ACCESS_EVALUATION_FORMAT_OPA)
+		}
+
+		return &opaAdapter{
+			endpoint:    strings.TrimSuffix(accessEvaluationAPI.Endpoint, "/") + OPA_DATA_API_PATH + strings.ReplaceAll(strings.Trim(accessEvaluationAPI.Package, "/."), ".", "/"),
+			resultPaths: resultPaths.withDefaults(ResultPaths{Decision: "result", Reasons: "result.reasons"}),
+			post:        post,
+			logger:      logger,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported access evaluation format %q", accessEvaluationAPI.Format)
+	}
+}
+
+func (p ResultPaths) withDefaults(defaults ResultPaths) ResultPaths {
+	if p.Decision == "" {
+		p.Decision = defaults.Decision
+	}
+
+	if p.Reasons == "" {
+		p.Reasons = defaults.Reasons
+	}
+
+	return p
+}
+
+// decision returns the boolean at the decision path of a response. A response without a decision denies access.
+func (p ResultPaths) decision(response []byte) (bool, error) {
+	result := gjson.GetBytes(response, p.Decision)
+	if !result.Exists() {
+		return false, nil
+	}
+
+	if result.Type != gjson.True && result.Type != gjson.False {
+		return false, fmt.Errorf("access evaluation api response has no boolean decision at %s", p.Decision)
+	}
+
+	return result.Bool(), nil
+}
+
+// reasons returns the value at the reasons path of a response, if any.
+func (p ResultPaths) reasons(response []byte) interface{} {
+	return gjson.GetBytes(response, p.Reasons).Value()
+}
+
+// genericAdapter posts the resolved mapping to the endpoint as it is.
+type genericAdapter struct {
+	endpoint    string
+	resultPaths ResultPaths
+	post        postFunc
+	logger      *zap.Logger
+}
+
+func (a *genericAdapter) Evaluate(ctx context.Context, requestData interface{}) (bool, http.Header, error) {
+	var response json.RawMessage
+
+	header, err := a.post(ctx, a.endpoint, requestData, &response)
+	if err != nil {
+		return false, nil, err
+	}
+
+	decision, err := a.resultPaths.decision(response)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if !decision {
+		a.logger.Info("Access evaluation api denied the request.", zap.Any("reasons", a.resultPaths.reasons(response)))
+	}
+
+	return decision, header, nil
+}
+
+const OPA_DATA_API_PATH = "/v1/data/"
+
+// opaAdapter queries a policy decision with the data API of Open Policy Agent, posting {"input": <mapping>} to
+// /v1/data/<package>. The result may be a boolean, or an object with an allow field, e.g. {"allow": true,
+// "reasons": [...]}. An undefined result denies access.
+type opaAdapter struct {
+	endpoint    string
+	resultPaths ResultPaths
+	post        postFunc
+	logger      *zap.Logger
+}
+
+func (a *opaAdapter) Evaluate(ctx context.Context, requestData interface{}) (bool, http.Header, error) {
+	var response json.RawMessage
+
+	header, err := a.post(ctx, a.endpoint, map[string]interface{}{"input": requestData}, &response)
+	if err != nil {
+		return false, nil, err
+	}
+
+	resultPaths := a.resultPaths
+
+	result := gjson.GetBytes(response, resultPaths.Decision)
+	if !result.Exists() {
+		a.logger.Info("OPA policy decision is undefined; denying the request.", zap.String("endpoint", a.endpoint))
+
+		return false, header, nil
+	}
+
+	if result.IsObject() {
+		resultPaths.Decision += ".allow"
+	}
+
+	decision, err := resultPaths.decision(response)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if !decision {
+		a.logger.Info("OPA denied the request.", zap.Any("reasons", resultPaths.reasons(response)))
+	}
+
+	return decision, header, nil
+}
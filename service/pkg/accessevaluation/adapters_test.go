@@ -0,0 +1,196 @@
+package accessevaluation
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestOPAAdapterEvaluate(t *testing.T) {
+	requestData := map[string]interface{}{"user": "alice", "amount": 250.0}
+
+	tests := []struct {
+		name        string
+		resultPaths *ResultPaths
+		response    string
+		want        bool
+		wantErr     bool
+	}{
+		{
+			name:     "boolean result permitted",
+			response: `{"result": true}`,
+			want:     true,
+		},
+		{
+			name:     "boolean result denied",
+			response: `{"result": false}`,
+		},
+		{
+			name:     "object result permitted",
+			response: `{"result": {"allow": true}}`,
+			want:     true,
+		},
+		{
+			name:     "object result denied with reasons",
+			response: `{"result": {"allow": false, "reasons": ["amount over limit"]}}`,
+		},
+		{
+			name:     "object result without allow",
+			response: `{"result": {"reasons": []}}`,
+		},
+		{
+			name:     "undefined result",
+			response: `{}`,
+		},
+		{
+			name:        "custom decision path",
+			resultPaths: &ResultPaths{Decision: "result.transfer.permit"},
+			response:    `{"result": {"transfer": {"permit": true}}}`,
+			want:        true,
+		},
+		{
+			name:        "custom decision path to an object",
+			resultPaths: &ResultPaths{Decision: "result.transfer"},
+			response:    `{"result": {"transfer": {"allow": true}}}`,
+			want:        true,
+		},
+		{
+			name:     "non-boolean result",
+			response: `{"result": "allow"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "non-boolean allow",
+			response: `{"result": {"allow": 1}}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &testPost{response: tt.response}
+			adapter := newTestAdapter(t, AccessEvaluationAPI{
+				Endpoint:    "https://opa.example/",
+				Format:      ACCESS_EVALUATION_FORMAT_OPA,
+				Package:     "authz.transfers",
+				ResultPaths: tt.resultPaths,
+			}, post)
+
+			decision, _, err := adapter.Evaluate(context.Background(), requestData)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if decision != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", decision, tt.want)
+			}
+
+			if wantEndpoint := "https://opa.example/v1/data/authz/transfers"; post.endpoint != wantEndpoint {
+				t.Errorf("Evaluate() posted to %q, want %q", post.endpoint, wantEndpoint)
+			}
+
+			if wantRequest := `{"input":{"amount":250,"user":"alice"}}`; post.request != wantRequest {
+				t.Errorf("Evaluate() posted %s, want %s", post.request, wantRequest)
+			}
+		})
+	}
+}
+
+func TestGenericAdapterEvaluate(t *testing.T) {
+	tests := []struct {
+		name        string
+		resultPaths *ResultPaths
+		response    string
+		want        bool
+		wantErr     bool
+	}{
+		{
+			name:     "permitted",
+			response: `{"decision": true}`,
+			want:     true,
+		},
+		{
+			name:     "denied",
+			response: `{"decision": false, "context": {"reason": "not the owner"}}`,
+		},
+		{
+			name:     "without a decision",
+			response: `{"allowed": true}`,
+		},
+		{
+			name:        "custom decision path",
+			resultPaths: &ResultPaths{Decision: "result.allowed"},
+			response:    `{"result": {"allowed": true}}`,
+			want:        true,
+		},
+		{
+			name:     "non-boolean decision",
+			response: `{"decision": "permit"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &testPost{response: tt.response}
+			adapter := newTestAdapter(t, AccessEvaluationAPI{Endpoint: "https://pdp.example/evaluate", ResultPaths: tt.resultPaths}, post)
+
+			decision, _, err := adapter.Evaluate(context.Background(), map[string]interface{}{"user": "alice"})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if decision != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", decision, tt.want)
+			}
+
+			if post.endpoint != "https://pdp.example/evaluate" || post.request != `{"user":"alice"}` {
+				t.Errorf("Evaluate() posted %s to %q, want the mapping as it is", post.request, post.endpoint)
+			}
+		})
+	}
+}
+
+func TestNewAdapter(t *testing.T) {
+	tests := []struct {
+		name                string
+		accessEvaluationAPI AccessEvaluationAPI
+		wantErr             bool
+	}{
+		{
+			name:                "generic by default",
+			accessEvaluationAPI: AccessEvaluationAPI{Endpoint: "https://pdp.example"},
+		},
+		{
+			name:                "authzen",
+			accessEvaluationAPI: AccessEvaluationAPI{Endpoint: "https://pdp.example", Format: ACCESS_EVALUATION_FORMAT_AUTHZEN},
+		},
+		{
+			name:                "opa with a package",
+			accessEvaluationAPI: AccessEvaluationAPI{Endpoint: "https://opa.example", Format: ACCESS_EVALUATION_FORMAT_OPA, Package: "authz"},
+		},
+		{
+			name:                "opa without a package",
+			accessEvaluationAPI: AccessEvaluationAPI{Endpoint: "https://opa.example", Format: ACCESS_EVALUATION_FORMAT_OPA},
+			wantErr:             true,
+		},
+		{
+			name:                "unsupported format",
+			accessEvaluationAPI: AccessEvaluationAPI{Endpoint: "https://pdp.example", Format: "xacml"},
+			wantErr:             true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &testPost{}
+
+			if _, err := newAdapter(tt.accessEvaluationAPI, post.post, zap.NewNop()); (err != nil) != tt.wantErr {
+				t.Errorf("newAdapter() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
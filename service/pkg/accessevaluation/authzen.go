@@ -0,0 +1,318 @@
+package accessevaluation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
+)
+
+const (
+	AUTHZEN_EVALUATION_PATH  = "/access/v1/evaluation"
+	AUTHZEN_EVALUATIONS_PATH = "/access/v1/evaluations"
+)
+
+const (
+	AUTHZEN_EXECUTE_ALL            = "execute_all"
+	AUTHZEN_DENY_ON_FIRST_DENY     = "deny_on_first_deny"
+	AUTHZEN_PERMIT_ON_FIRST_PERMIT = "permit_on_first_permit"
+)
+
+type authZENEntity struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type authZENAction struct {
+	Name       string                 `json:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type authZENEvaluation struct {
+	Subject  *authZENEntity         `json:"subject,omitempty"`
+	Action   *authZENAction         `json:"action,omitempty"`
+	Resource *authZENEntity         `json:"resource,omitempty"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+// authZENEvaluations is a batch request. The subject, action, resource and context of the top level are the
+// defaults of every evaluation.
+type authZENEvaluations struct {
+	authZENEvaluation
+	Evaluations []authZENEvaluation    `json:"evaluations"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+}
+
+// authZENAdapter follows the OpenID AuthZEN Authorization API. A PDP may explain its decisions in the context of
+// its responses, e.g. with reason_admin and reason_user. The result paths apply to the response of each evaluation.
+type authZENAdapter struct {
+	endpoint    string
+	resultPaths ResultPaths
+	post        postFunc
+	logger      *zap.Logger
+}
+
+// Evaluate evaluates the resolved access evaluation mapping of a rule. A mapping with subject, action, resource
+// and context keys is a single evaluation; a mapping with an evaluations list is a batch, which is permitted if all
+// of its evaluations are, or any of them with the permit_on_first_permit semantic.
+func (a *authZENAdapter) Evaluate(ctx context.Context, requestData interface{}) (bool, http.Header, error) {
+	mapping, ok := requestData.(map[string]interface{})
+	if !ok {
+		return false, nil, fmt.Errorf("authzen access evaluation mapping must be an object, got %T", requestData)
+	}
+
+	if _, ok := mapping["evaluations"]; !ok {
+		request, err := parseAuthZENEvaluation(mapping)
+		if err != nil {
+			return false, nil, err
+		}
+
+		if err := request.validate(); err != nil {
+			return false, nil, err
+		}
+
+		var response json.RawMessage
+
+		header, err := a.post(ctx, a.endpoint+AUTHZEN_EVALUATION_PATH, request, &response)
+		if err != nil {
+			return false, nil, err
+		}
+
+		decision, err := a.resultPaths.decision(response)
+		if err != nil {
+			return false, nil, err
+		}
+
+		if !decision {
+			a.logger.Info("Access evaluation api denied the request.", zap.Any("reasons", a.resultPaths.reasons(response)))
+		}
+
+		return decision, header, nil
+	}
+
+	request, err := parseAuthZENEvaluations(mapping)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var response json.RawMessage
+
+	header, err := a.post(ctx, a.endpoint+AUTHZEN_EVALUATIONS_PATH, request, &response)
+	if err != nil {
+		return false, nil, err
+	}
+
+	decision, err := a.batchDecision(request, gjson.GetBytes(response, "evaluations").Array())
+
+	return decision, header, err
+}
+
+func (a *authZENAdapter) batchDecision(request *authZENEvaluations, responses []gjson.Result) (bool, error) {
+	semantic, _ := request.Options["evaluations_semantic"].(string)
+
+	decisions := make([]bool, 0, len(responses))
+
+	for i, response := range responses {
+		decision, err := a.resultPaths.decision([]byte(response.Raw))
+		if err != nil {
+			return false, fmt.Errorf("authzen evaluation %d: %w", i, err)
+		}
+
+		decisions = append(decisions, decision)
+	}
+
+	if semantic == AUTHZEN_PERMIT_ON_FIRST_PERMIT {
+		for _, decision := range decisions {
+			if decision {
+				return true, nil
+			}
+		}
+
+		a.logger.Info("Access evaluation api denied every evaluation of the request.")
+
+		return false, nil
+	}
+
+	for i, decision := range decisions {
+		if !decision {
+			a.logger.Info("Access evaluation api denied the request.", zap.Int("evaluation", i), zap.Any("reasons", a.resultPaths.reasons([]byte(responses[i].Raw))))
+
+			return false, nil
+		}
+	}
+
+	if len(decisions) != len(request.Evaluations) {
+		return false, fmt.Errorf("access evaluation api returned %d decisions for %d evaluations", len(decisions), len(request.Evaluations))
+	}
+
+	return true, nil
+}
+
+func parseAuthZENEvaluation(mapping map[string]interface{}) (authZENEvaluation, error) {
+	var evaluation authZENEvaluation
+
+	var err error
+
+	if evaluation.Subject, err = parseAuthZENEntity(mapping, "subject"); err != nil {
+		return authZENEvaluation{}, err
+	}
+
+	if evaluation.Resource, err = parseAuthZENEntity(mapping, "resource"); err != nil {
+		return authZENEvaluation{}, err
+	}
+
+	if value, ok := mapping["action"]; ok {
+		action, ok := value.(map[string]interface{})
+		if !ok {
+			return authZENEvaluation{}, fmt.Errorf("authzen action must be an object, got %T", value)
+		}
+
+		evaluation.Action = &authZENAction{Name: stringValue(action["name"])}
+
+		if evaluation.Action.Properties, err = properties(action, "action"); err != nil {
+			return authZENEvaluation{}, err
+		}
+	}
+
+	if value, ok := mapping["context"]; ok {
+		if evaluation.Context, ok = value.(map[string]interface{}); !ok {
+			return authZENEvaluation{}, fmt.Errorf("authzen context must be an object, got %T", value)
+		}
+	}
+
+	return evaluation, nil
+}
+
+func parseAuthZENEvaluations(mapping map[string]interface{}) (*authZENEvaluations, error) {
+	defaults, err := parseAuthZENEvaluation(mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := mapping["evaluations"].([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.New("authzen evaluations must be a non-empty list")
+	}
+
+	request := &authZENEvaluations{
+		authZENEvaluation: defaults,
+		Evaluations:       make([]authZENEvaluation, 0, len(items)),
+	}
+
+	if value, ok := mapping["options"]; ok {
+		if request.Options, ok = value.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("authzen options must be an object, got %T", value)
+		}
+	}
+
+	for i, item := range items {
+		itemMapping, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("authzen evaluation %d must be an object, got %T", i, item)
+		}
+
+		evaluation, err := parseAuthZENEvaluation(itemMapping)
+		if err != nil {
+			return nil, fmt.Errorf("authzen evaluation %d: %w", i, err)
+		}
+
+		if err := evaluation.withDefaults(defaults).validate(); err != nil {
+			return nil, fmt.Errorf("authzen evaluation %d: %w", i, err)
+		}
+
+		request.Evaluations = append(request.Evaluations, evaluation)
+	}
+
+	return request, nil
+}
+
+func parseAuthZENEntity(mapping map[string]interface{}, field string) (*authZENEntity, error) {
+	value, ok := mapping[field]
+	if !ok {
+		return nil, nil
+	}
+
+	entity, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("authzen %s must be an object, got %T", field, value)
+	}
+
+	entityProperties, err := properties(entity, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authZENEntity{
+		Type:       stringValue(entity["type"]),
+		ID:         stringValue(entity["id"]),
+		Properties: entityProperties,
+	}, nil
+}
+
+func properties(mapping map[string]interface{}, field string) (map[string]interface{}, error) {
+	value, ok := mapping["properties"]
+	if !ok {
+		return nil, nil
+	}
+
+	entityProperties, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("authzen %s properties must be an object, got %T", field, value)
+	}
+
+	return entityProperties, nil
+}
+
+// stringValue returns the string form of a resolved value, since AuthZEN identifiers are strings while the
+// values they are resolved from may be numbers.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (e authZENEvaluation) withDefaults(defaults authZENEvaluation) authZENEvaluation {
+	if e.Subject == nil {
+		e.Subject = defaults.Subject
+	}
+
+	if e.Action == nil {
+		e.Action = defaults.Action
+	}
+
+	if e.Resource == nil {
+		e.Resource = defaults.Resource
+	}
+
+	if e.Context == nil {
+		e.Context = defaults.Context
+	}
+
+	return e
+}
+
+func (e authZENEvaluation) validate() error {
+	switch {
+	case e.Subject == nil || e.Subject.Type == "" || e.Subject.ID == "":
+		return errors.New("authzen evaluation requires a subject with a type and an id")
+	case e.Action == nil || e.Action.Name == "":
+		return errors.New("authzen evaluation requires an action with a name")
+	case e.Resource == nil || e.Resource.Type == "" || e.Resource.ID == "":
+		return errors.New("authzen evaluation requires a resource with a type and an id")
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package accessevaluation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// testPost is a postFunc answering every request with response and recording the last request it was sent.
+type testPost struct {
+	response string
+	calls    int
+	endpoint string
+	request  string
+}
+
+func (p *testPost) post(ctx context.Context, endpoint string, requestData interface{}, response interface{}) (http.Header, error) {
+	p.calls++
+	p.endpoint = endpoint
+
+	request, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	p.request = string(request)
+
+	return http.Header{}, json.Unmarshal([]byte(p.response), response)
+}
+
+func newTestAdapter(t *testing.T, accessEvaluationAPI AccessEvaluationAPI, post *testPost) Adapter {
+	t.Helper()
+
+	adapter, err := newAdapter(accessEvaluationAPI, post.post, zap.NewNop())
+	if err != nil {
+		t.Fatalf("newAdapter() error = %v", err)
+	}
+
+	return adapter
+}
+
+func TestAuthZENAdapterEvaluate(t *testing.T) {
+	subject := map[string]interface{}{"type": "user", "id": "alice"}
+	action := map[string]interface{}{"name": "read"}
+	resource := map[string]interface{}{"type": "account", "id": 42.0}
+
+	tests := []struct {
+		name         string
+		mapping      map[string]interface{}
+		response     string
+		want         bool
+		wantErr      bool
+		wantEndpoint string
+		wantRequest  string
+	}{
+		{
+			name:         "single evaluation permitted",
+			mapping:      map[string]interface{}{"subject": subject, "action": action, "resource": resource},
+			response:     `{"decision": true}`,
+			want:         true,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATION_PATH,
+			wantRequest:  `{"subject":{"type":"user","id":"alice"},"action":{"name":"read"},"resource":{"type":"account","id":"42"}}`,
+		},
+		{
+			name:         "single evaluation denied",
+			mapping:      map[string]interface{}{"subject": subject, "action": action, "resource": resource},
+			response:     `{"decision": false, "context": {"reason_admin": {"en": "not the owner"}}}`,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATION_PATH,
+		},
+		{
+			name:         "single evaluation without a decision",
+			mapping:      map[string]interface{}{"subject": subject, "action": action, "resource": resource},
+			response:     `{}`,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATION_PATH,
+		},
+		{
+			name:    "single evaluation without a resource id",
+			mapping: map[string]interface{}{"subject": subject, "action": action, "resource": map[string]interface{}{"type": "account"}},
+			wantErr: true,
+		},
+		{
+			name: "batch permitted when every evaluation is",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"resource": map[string]interface{}{"type": "account", "id": "43"}}},
+			},
+			response:     `{"evaluations": [{"decision": true}, {"decision": true}]}`,
+			want:         true,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+			wantRequest:  `{"subject":{"type":"user","id":"alice"},"action":{"name":"read"},"evaluations":[{"resource":{"type":"account","id":"42"}},{"resource":{"type":"account","id":"43"}}]}`,
+		},
+		{
+			name: "batch denied when any evaluation is",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"action": map[string]interface{}{"name": "delete"}, "resource": resource}},
+			},
+			response:     `{"evaluations": [{"decision": true}, {"decision": false}]}`,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch with deny on first deny that stops early",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"resource": resource}},
+				"options":     map[string]interface{}{"evaluations_semantic": AUTHZEN_DENY_ON_FIRST_DENY},
+			},
+			response:     `{"evaluations": [{"decision": false}]}`,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch permitted on first permit",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"resource": resource}},
+				"options":     map[string]interface{}{"evaluations_semantic": AUTHZEN_PERMIT_ON_FIRST_PERMIT},
+			},
+			response:     `{"evaluations": [{"decision": false}, {"decision": true}]}`,
+			want:         true,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch denied when no evaluation is permitted on first permit",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"resource": resource}},
+				"options":     map[string]interface{}{"evaluations_semantic": AUTHZEN_PERMIT_ON_FIRST_PERMIT},
+			},
+			response:     `{"evaluations": [{"decision": false}, {"decision": false}]}`,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch with fewer decisions than evaluations",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}, map[string]interface{}{"resource": resource}},
+			},
+			response:     `{"evaluations": [{"decision": true}]}`,
+			wantErr:      true,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch with a non-boolean decision",
+			mapping: map[string]interface{}{
+				"subject":     subject,
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}},
+			},
+			response:     `{"evaluations": [{"decision": "yes"}]}`,
+			wantErr:      true,
+			wantEndpoint: "https://pdp.example" + AUTHZEN_EVALUATIONS_PATH,
+		},
+		{
+			name: "batch evaluation without a subject or a default subject",
+			mapping: map[string]interface{}{
+				"action":      action,
+				"evaluations": []interface{}{map[string]interface{}{"resource": resource}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "empty batch",
+			mapping: map[string]interface{}{"subject": subject, "action": action, "evaluations": []interface{}{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := &testPost{response: tt.response}
+			adapter := newTestAdapter(t, AccessEvaluationAPI{Endpoint: "https://pdp.example/", Format: ACCESS_EVALUATION_FORMAT_AUTHZEN}, post)
+
+			decision, _, err := adapter.Evaluate(context.Background(), tt.mapping)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if decision != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", decision, tt.want)
+			}
+
+			if post.endpoint != tt.wantEndpoint {
+				t.Errorf("Evaluate() posted to %q, want %q", post.endpoint, tt.wantEndpoint)
+			}
+
+			if tt.wantRequest != "" && post.request != tt.wantRequest {
+				t.Errorf("Evaluate() posted %s, want %s", post.request, tt.wantRequest)
+			}
+		})
+	}
+}
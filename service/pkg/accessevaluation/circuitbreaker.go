@@ -0,0 +1,104 @@
+package accessevaluation
+
+import (
+	"sync"
+	"time"
+)
+
+const DEFAULT_CIRCUIT_BREAKER_OPEN_DURATION = 30 * time.Second
+
+// CircuitBreaker stops calls to an access evaluation api after FailureThreshold consecutive failed evaluations.
+// After OpenDuration, 30s by default, one evaluation is let through; it closes the circuit if it succeeds.
+type CircuitBreaker struct {
+	FailureThreshold int    `json:"failureThreshold"`
+	OpenDuration     string `json:"openDuration,omitempty"`
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitBreaker struct {
+	mu                  sync.Mutex
+	failureThreshold    int
+	openDuration        time.Duration
+	state               circuitState
+	consecutiveFailures int
+	openedAt            time.Time
+	now                 func() time.Time
+}
+
+func newCircuitBreaker(config CircuitBreaker) (*circuitBreaker, error) {
+	openDuration := DEFAULT_CIRCUIT_BREAKER_OPEN_DURATION
+
+	if config.OpenDuration != "" {
+		var err error
+
+		if openDuration, err = time.ParseDuration(config.OpenDuration); err != nil {
+			return nil, err
+		}
+	}
+
+	return &circuitBreaker{
+		failureThreshold: config.FailureThreshold,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}, nil
+}
+
+// allow reports whether an evaluation may call the api. In the half-open state only one evaluation is let through
+// until its result is recorded.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openDuration {
+			return false
+		}
+
+		cb.state = circuitHalfOpen
+
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if success {
+		cb.state = circuitClosed
+		cb.consecutiveFailures = 0
+
+		return
+	}
+
+	cb.consecutiveFailures++
+
+	if cb.state == circuitHalfOpen || cb.consecutiveFailures >= cb.failureThreshold {
+		cb.state = circuitOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// release returns the evaluation let through by allow without a result, e.g. because its caller cancelled it. A
+// released half-open probe reopens the circuit without counting a failure, keeping the time it opened at, so
+// that the next evaluation probes the api.
+func (cb *circuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		cb.state = circuitOpen
+	}
+}
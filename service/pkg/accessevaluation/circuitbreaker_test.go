@@ -0,0 +1,138 @@
+package accessevaluation
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	stepAllow   = "allow"
+	stepSuccess = "success"
+	stepFailure = "failure"
+	stepRelease = "release"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	type step struct {
+		// after is the time since the first step.
+		after     time.Duration
+		action    string
+		wantAllow bool
+		wantState circuitState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after consecutive failures",
+			steps: []step{
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepFailure, wantState: circuitOpen},
+				{action: stepAllow, after: time.Second, wantAllow: false, wantState: circuitOpen},
+			},
+		},
+		{
+			name: "successes reset the failure count",
+			steps: []step{
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepSuccess, wantState: circuitClosed},
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepFailure, wantState: circuitClosed},
+				{action: stepAllow, wantAllow: true, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "lets one evaluation through after the open duration",
+			steps: []step{
+				{action: stepFailure},
+				{action: stepFailure},
+				{action: stepFailure, wantState: circuitOpen},
+				{action: stepAllow, after: 9 * time.Second, wantAllow: false, wantState: circuitOpen},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: false, wantState: circuitHalfOpen},
+			},
+		},
+		{
+			name: "closes when the half-open evaluation succeeds",
+			steps: []step{
+				{action: stepFailure},
+				{action: stepFailure},
+				{action: stepFailure, wantState: circuitOpen},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+				{action: stepSuccess, after: 10 * time.Second, wantState: circuitClosed},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: true, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "reopens when the half-open evaluation fails",
+			steps: []step{
+				{action: stepFailure},
+				{action: stepFailure},
+				{action: stepFailure, wantState: circuitOpen},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+				{action: stepFailure, after: 10 * time.Second, wantState: circuitOpen},
+				{action: stepAllow, after: 19 * time.Second, wantAllow: false, wantState: circuitOpen},
+				{action: stepAllow, after: 20 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+			},
+		},
+		{
+			name: "released half-open probes reopen the circuit for the next evaluation",
+			steps: []step{
+				{action: stepFailure},
+				{action: stepFailure},
+				{action: stepFailure, wantState: circuitOpen},
+				{action: stepAllow, after: 10 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+				{action: stepRelease, after: 11 * time.Second, wantState: circuitOpen},
+				{action: stepAllow, after: 11 * time.Second, wantAllow: true, wantState: circuitHalfOpen},
+				{action: stepSuccess, after: 11 * time.Second, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "releases while closed change nothing",
+			steps: []step{
+				{action: stepFailure},
+				{action: stepRelease, wantState: circuitClosed},
+				{action: stepFailure},
+				{action: stepFailure, wantState: circuitOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuitBreaker, err := newCircuitBreaker(CircuitBreaker{FailureThreshold: 3, OpenDuration: "10s"})
+			if err != nil {
+				t.Fatalf("newCircuitBreaker() error = %v", err)
+			}
+
+			start := time.Now()
+			now := start
+			circuitBreaker.now = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = start.Add(step.after)
+
+				switch step.action {
+				case stepAllow:
+					if allow := circuitBreaker.allow(); allow != step.wantAllow {
+						t.Errorf("step %d: allow() = %v, want %v", i, allow, step.wantAllow)
+					}
+				case stepSuccess:
+					circuitBreaker.record(true)
+				case stepFailure:
+					circuitBreaker.record(false)
+				case stepRelease:
+					circuitBreaker.release()
+				}
+
+				if circuitBreaker.state != step.wantState {
+					t.Errorf("step %d: state = %v, want %v", i, circuitBreaker.state, step.wantState)
+				}
+			}
+		})
+	}
+}
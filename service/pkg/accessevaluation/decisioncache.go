@@ -0,0 +1,167 @@
+package accessevaluation
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_DECISION_CACHE_MAX_ENTRIES = 10000
+
+// DecisionCache configures the caching of access evaluation decisions. PermitTTL and DenyTTL are durations such as
+// "30s"; a decision whose TTL is not set is not cached. A PDP can shorten the TTL of a decision, or prevent its
+// caching, with the Cache-Control max-age, no-cache and no-store directives, but not extend it.
+type DecisionCache struct {
+	PermitTTL  string `json:"permitTTL,omitempty"`
+	DenyTTL    string `json:"denyTTL,omitempty"`
+	MaxEntries int    `json:"maxEntries,omitempty"`
+}
+
+type cachedDecision struct {
+	key      string
+	decision bool
+	expiry   time.Time
+}
+
+// decisionCache is a least recently used cache of decisions keyed by the canonicalized access evaluation request.
+// It belongs to an AccessEvaluator, so it is dropped with the evaluator when the access evaluation api is
+// reconfigured.
+type decisionCache struct {
+	mu         sync.Mutex
+	permitTTL  time.Duration
+	denyTTL    time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List
+	now        func() time.Time
+}
+
+func newDecisionCache(config DecisionCache) (*decisionCache, error) {
+	cache := &decisionCache{
+		maxEntries: config.MaxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+
+	var err error
+
+	if cache.permitTTL, err = parseTTL(config.PermitTTL); err != nil {
+		return nil, fmt.Errorf("invalid permit TTL: %w", err)
+	}
+
+	if cache.denyTTL, err = parseTTL(config.DenyTTL); err != nil {
+		return nil, fmt.Errorf("invalid deny TTL: %w", err)
+	}
+
+	if cache.maxEntries == 0 {
+		cache.maxEntries = DEFAULT_DECISION_CACHE_MAX_ENTRIES
+	}
+
+	return cache, nil
+}
+
+func parseTTL(ttl string) (time.Duration, error) {
+	if ttl == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, err
+	}
+
+	if duration < 0 {
+		return 0, fmt.Errorf("%s is negative", ttl)
+	}
+
+	return duration, nil
+}
+
+func (c *decisionCache) get(key string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+
+	entry := element.Value.(*cachedDecision)
+
+	if c.now().After(entry.expiry) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+
+		return false, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return entry.decision, true
+}
+
+// set caches a decision for its TTL, shortened by the Cache-Control header of the PDP response.
+func (c *decisionCache) set(key string, decision bool, header http.Header) {
+	ttl := c.denyTTL
+	if decision {
+		ttl = c.permitTTL
+	}
+
+	if maxAge, ok := cacheControlMaxAge(header); ok && maxAge < ttl {
+		ttl = maxAge
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+
+	c.entries[key] = c.order.PushFront(&cachedDecision{key: key, decision: decision, expiry: c.now().Add(ttl)})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedDecision).key)
+	}
+}
+
+// cacheControlMaxAge returns how long the PDP allows its response to be cached, which is zero for no-cache and
+// no-store responses.
+func cacheControlMaxAge(header http.Header) (time.Duration, bool) {
+	if header == nil {
+		return 0, false
+	}
+
+	var maxAge time.Duration
+
+	found := false
+
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			found = true
+
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds > 0 {
+				maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return maxAge, found
+}
@@ -0,0 +1,200 @@
+package accessevaluation
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDecisionCacheTTL(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       DecisionCache
+		decision     bool
+		cacheControl string
+		// after is the time since the decision was cached.
+		after     time.Duration
+		wantFound bool
+	}{
+		{
+			name:      "permit within its TTL",
+			config:    DecisionCache{PermitTTL: "30s", DenyTTL: "5s"},
+			decision:  true,
+			after:     10 * time.Second,
+			wantFound: true,
+		},
+		{
+			name:     "permit after its TTL",
+			config:   DecisionCache{PermitTTL: "30s", DenyTTL: "5s"},
+			decision: true,
+			after:    31 * time.Second,
+		},
+		{
+			name:     "deny after its TTL",
+			config:   DecisionCache{PermitTTL: "30s", DenyTTL: "5s"},
+			decision: false,
+			after:    10 * time.Second,
+		},
+		{
+			name:      "deny within its TTL",
+			config:    DecisionCache{PermitTTL: "30s", DenyTTL: "5s"},
+			decision:  false,
+			after:     time.Second,
+			wantFound: true,
+		},
+		{
+			name:     "decision without a TTL is not cached",
+			config:   DecisionCache{PermitTTL: "30s"},
+			decision: false,
+		},
+		{
+			name:         "max-age shortens the TTL",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "private, max-age=10",
+			after:        11 * time.Second,
+		},
+		{
+			name:         "max-age does not extend the TTL",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "max-age=3600",
+			after:        31 * time.Second,
+		},
+		{
+			name:         "max-age longer than the TTL keeps the TTL",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "max-age=3600",
+			after:        29 * time.Second,
+			wantFound:    true,
+		},
+		{
+			name:         "no-store prevents caching",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "no-store",
+		},
+		{
+			name:         "no-cache prevents caching",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "max-age=10, No-Cache",
+		},
+		{
+			name:         "max-age of zero prevents caching",
+			config:       DecisionCache{PermitTTL: "30s"},
+			decision:     true,
+			cacheControl: "max-age=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := newDecisionCache(tt.config)
+			if err != nil {
+				t.Fatalf("newDecisionCache() error = %v", err)
+			}
+
+			start := time.Now()
+			now := start
+			cache.now = func() time.Time { return now }
+
+			header := http.Header{}
+			if tt.cacheControl != "" {
+				header.Set("Cache-Control", tt.cacheControl)
+			}
+
+			cache.set("key", tt.decision, header)
+
+			now = start.Add(tt.after)
+
+			decision, found := cache.get("key")
+
+			if found != tt.wantFound {
+				t.Fatalf("get() found = %v, want %v", found, tt.wantFound)
+			}
+
+			if found && decision != tt.decision {
+				t.Errorf("get() = %v, want %v", decision, tt.decision)
+			}
+		})
+	}
+}
+
+func TestDecisionCacheEviction(t *testing.T) {
+	cache, err := newDecisionCache(DecisionCache{PermitTTL: "1m", MaxEntries: 2})
+	if err != nil {
+		t.Fatalf("newDecisionCache() error = %v", err)
+	}
+
+	cache.set("a", true, nil)
+	cache.set("b", true, nil)
+
+	// Reading a makes b the least recently used entry.
+	if _, found := cache.get("a"); !found {
+		t.Fatalf("get(a) found = false, want true")
+	}
+
+	cache.set("c", true, nil)
+
+	for key, wantFound := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, found := cache.get(key); found != wantFound {
+			t.Errorf("get(%s) found = %v, want %v", key, found, wantFound)
+		}
+	}
+}
+
+func TestCacheControlMaxAge(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		want         time.Duration
+		wantFound    bool
+	}{
+		{
+			name: "no Cache-Control header",
+		},
+		{
+			name:         "max-age",
+			cacheControl: "max-age=60",
+			want:         time.Minute,
+			wantFound:    true,
+		},
+		{
+			name:         "max-age among other directives",
+			cacheControl: "private, Max-Age=15, must-revalidate",
+			want:         15 * time.Second,
+			wantFound:    true,
+		},
+		{
+			name:         "invalid max-age",
+			cacheControl: "max-age=soon",
+			wantFound:    true,
+		},
+		{
+			name:         "no-store",
+			cacheControl: "max-age=60, no-store",
+			wantFound:    true,
+		},
+		{
+			name:         "directives without a lifetime",
+			cacheControl: "private, must-revalidate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.cacheControl != "" {
+				header.Set("Cache-Control", tt.cacheControl)
+			}
+
+			maxAge, found := cacheControlMaxAge(header)
+
+			if maxAge != tt.want || found != tt.wantFound {
+				t.Errorf("cacheControlMaxAge() = %v, %v, want %v, %v", maxAge, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
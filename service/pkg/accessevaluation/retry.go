@@ -0,0 +1,86 @@
+package accessevaluation
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	DEFAULT_ACCESS_EVALUATION_TIMEOUT = 5 * time.Second
+	DEFAULT_RETRY_INITIAL_BACKOFF     = 100 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF         = 2 * time.Second
+)
+
+// Retry configures the retries of access evaluation requests that fail because the api is unavailable: connection
+// errors, timeouts, 429 and 5xx responses. The backoff doubles from InitialBackoff up to MaxBackoff, with jitter.
+type Retry struct {
+	MaxAttempts    int    `json:"maxAttempts"`
+	InitialBackoff string `json:"initialBackoff,omitempty"`
+	MaxBackoff     string `json:"maxBackoff,omitempty"`
+}
+
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(config *Retry) (retryPolicy, error) {
+	policy := retryPolicy{
+		maxAttempts:    1,
+		initialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF,
+		maxBackoff:     DEFAULT_RETRY_MAX_BACKOFF,
+	}
+
+	if config == nil {
+		return policy, nil
+	}
+
+	if config.MaxAttempts > 1 {
+		policy.maxAttempts = config.MaxAttempts
+	}
+
+	var err error
+
+	if config.InitialBackoff != "" {
+		if policy.initialBackoff, err = time.ParseDuration(config.InitialBackoff); err != nil {
+			return retryPolicy{}, err
+		}
+	}
+
+	if config.MaxBackoff != "" {
+		if policy.maxBackoff, err = time.ParseDuration(config.MaxBackoff); err != nil {
+			return retryPolicy{}, err
+		}
+	}
+
+	return policy, nil
+}
+
+// wait sleeps before the given retry, counted from 1, and returns false if ctx is done first.
+func (p retryPolicy) wait(ctx context.Context, retry int) bool {
+	timer := time.NewTimer(p.backoff(retry))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff returns the jittered backoff before the given retry, between half and all of the doubled backoff.
+func (p retryPolicy) backoff(retry int) time.Duration {
+	backoff := p.initialBackoff << (retry - 1)
+	if backoff > p.maxBackoff || backoff <= 0 {
+		backoff = p.maxBackoff
+	}
+
+	if backoff >= 2 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)))
+	}
+
+	return backoff
+}
@@ -0,0 +1,96 @@
+package accessevaluation
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Retry
+		want    retryPolicy
+		wantErr bool
+	}{
+		{
+			name: "no retries configured",
+			want: retryPolicy{maxAttempts: 1, initialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF, maxBackoff: DEFAULT_RETRY_MAX_BACKOFF},
+		},
+		{
+			name:   "zero attempts make one attempt",
+			config: &Retry{MaxAttempts: 0},
+			want:   retryPolicy{maxAttempts: 1, initialBackoff: DEFAULT_RETRY_INITIAL_BACKOFF, maxBackoff: DEFAULT_RETRY_MAX_BACKOFF},
+		},
+		{
+			name:   "custom backoff",
+			config: &Retry{MaxAttempts: 3, InitialBackoff: "50ms", MaxBackoff: "1s"},
+			want:   retryPolicy{maxAttempts: 3, initialBackoff: 50 * time.Millisecond, maxBackoff: time.Second},
+		},
+		{
+			name:    "invalid backoff",
+			config:  &Retry{MaxAttempts: 3, InitialBackoff: "fast"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newRetryPolicy(tt.config)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newRetryPolicy() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && policy != tt.want {
+				t.Errorf("newRetryPolicy() = %+v, want %+v", policy, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 10, initialBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	tests := []struct {
+		name  string
+		retry int
+		// The jittered backoff is between half of full and full.
+		full time.Duration
+	}{
+		{name: "first retry", retry: 1, full: 100 * time.Millisecond},
+		{name: "second retry", retry: 2, full: 200 * time.Millisecond},
+		{name: "third retry", retry: 3, full: 400 * time.Millisecond},
+		{name: "capped at the max backoff", retry: 5, full: time.Second},
+		{name: "capped when the shift overflows", retry: 64, full: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				backoff := policy.backoff(tt.retry)
+
+				if backoff < tt.full/2 || backoff >= tt.full {
+					t.Fatalf("backoff(%d) = %v, want in [%v, %v)", tt.retry, backoff, tt.full/2, tt.full)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 2, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	if !policy.wait(context.Background(), 1) {
+		t.Errorf("wait() = false, want true")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	policy.initialBackoff, policy.maxBackoff = time.Minute, time.Minute
+
+	if policy.wait(ctx, 1) {
+		t.Errorf("wait() with a cancelled context = true, want false")
+	}
+}
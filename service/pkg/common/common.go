@@ -68,4 +68,12 @@ type TokenRequest struct {
 	SubjectTokenType   TokenType
 	RequestDetails     RequestDetails
 	RequestContext     map[string]any
+	Requester          Requester
+}
+
+// Requester identifies the workload requesting a txn token, as authenticated by tokenetes rather than stated by the
+// caller.
+type Requester struct {
+	WorkloadID string
+	IP         string
 }
@@ -2,22 +2,69 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"time"
 
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 )
 
+const (
+	DEFAULT_SIGNING_KEY_ROTATION_INTERVAL = 24 * time.Hour
+	DEFAULT_SIGNING_KEY_GRACE_PERIOD      = 1 * time.Hour
+)
+
 type AppConfig struct {
-	TconfigdHost     string
-	TconfigdSpiffeID spiffeid.ID
-	MyNamespace      string
+	TconfigdHost               string
+	TconfigdSpiffeID           spiffeid.ID
+	MyNamespace                string
+	SigningKeysDir             string
+	SigningKeyRotationInterval time.Duration
+	SigningKeyGracePeriod      time.Duration
+	LearningMode               bool
+	PublicURLs                 PublicURLs
+}
+
+// PublicURLs are the base URLs the https and http servers are reached at. They are advertised in the authorization
+// server metadata; unset URLs are derived from the token issuer.
+type PublicURLs struct {
+	HTTPS *url.URL
+	HTTP  *url.URL
 }
 
 func GetAppConfig() (*AppConfig, error) {
+	signingKeyRotationInterval, err := getEnvDuration("SIGNING_KEY_ROTATION_INTERVAL", DEFAULT_SIGNING_KEY_ROTATION_INTERVAL)
+	if err != nil {
+		return nil, err
+	}
+
+	signingKeyGracePeriod, err := getEnvDuration("SIGNING_KEY_GRACE_PERIOD", DEFAULT_SIGNING_KEY_GRACE_PERIOD)
+	if err != nil {
+		return nil, err
+	}
+
+	publicHTTPSURL, err := getEnvURL("PUBLIC_HTTPS_URL", "https")
+	if err != nil {
+		return nil, err
+	}
+
+	publicHTTPURL, err := getEnvURL("PUBLIC_HTTP_URL", "http")
+	if err != nil {
+		return nil, err
+	}
+
 	return &AppConfig{
-		TconfigdHost:     getEnv("TCONFIGD_HOST"),
-		TconfigdSpiffeID: spiffeid.RequireFromString(getEnv("TCONFIGD_SPIFFE_ID")),
-		MyNamespace:      getEnv("MY_NAMESPACE"),
+		TconfigdHost:               getEnv("TCONFIGD_HOST"),
+		TconfigdSpiffeID:           spiffeid.RequireFromString(getEnv("TCONFIGD_SPIFFE_ID")),
+		MyNamespace:                getEnv("MY_NAMESPACE"),
+		SigningKeysDir:             os.Getenv("SIGNING_KEYS_DIR"),
+		SigningKeyRotationInterval: signingKeyRotationInterval,
+		SigningKeyGracePeriod:      signingKeyGracePeriod,
+		LearningMode:               os.Getenv("LEARNING_MODE") == "true",
+		PublicURLs: PublicURLs{
+			HTTPS: publicHTTPSURL,
+			HTTP:  publicHTTPURL,
+		},
 	}, nil
 }
 
@@ -29,3 +76,35 @@ func getEnv(key string) string {
 
 	return value
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s environment variable: %w", key, err)
+	}
+
+	return duration, nil
+}
+
+func getEnvURL(key string, scheme string) (*url.URL, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return nil, nil
+	}
+
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s environment variable: %w", key, err)
+	}
+
+	if parsedURL.Scheme != scheme || parsedURL.Host == "" || parsedURL.RawQuery != "" || parsedURL.Fragment != "" {
+		return nil, fmt.Errorf("invalid %s environment variable: must be an %s URL without query or fragment", key, scheme)
+	}
+
+	return parsedURL, nil
+}
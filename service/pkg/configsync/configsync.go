@@ -3,19 +3,24 @@ package configsync
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/spiffe/go-spiffe/v2/spiffetls/tlsconfig"
 	"github.com/spiffe/go-spiffe/v2/workloadapi"
 	"github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
 	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
 	"go.uber.org/zap"
 )
 
@@ -40,7 +45,10 @@ type Client struct {
 	conn             *websocket.Conn
 	send             chan []byte
 	done             chan struct{}
+	jwksUpdated      chan struct{}
 	closeOnce        sync.Once
+	connected        atomic.Bool
+	initialRulesSet  atomic.Bool
 }
 
 type MessageType string
@@ -49,6 +57,8 @@ const (
 	MessageTypeInitialRulesResponse                        MessageType = "INITIAL_RULES_RESPONSE"
 	MessageTypeGetJWKSRequest                              MessageType = "GET_JWKS_REQUEST"
 	MessageTypeGetJWKSResponse                             MessageType = "GET_JWKS_RESPONSE"
+	MessageTypeJWKSUpdateRequest                           MessageType = "JWKS_UPDATE_REQUEST"
+	MessageTypeJWKSUpdateResponse                          MessageType = "JWKS_UPDATE_RESPONSE"
 	MessageTypeTraTGenerationRuleUpsertRequest             MessageType = "TRAT_GENERATION_RULE_UPSERT_REQUEST"
 	MessageTypeTraTGenerationRuleUpsertResponse            MessageType = "TRAT_GENERATION_RULE_UPSERT_RESPONSE"
 	MessageTypeTokenetesConfigGenerationRuleUpsertRequest  MessageType = "TOKENETES_CONFIG_GENERATION_RULE_UPSERT_REQUEST"
@@ -97,6 +107,7 @@ func NewClient(tconfigdHost string, tconfigdSpiffeId spiffeid.ID, namespace stri
 		namespace:        namespace,
 		generationRules:  generationRules,
 		logger:           logger,
+		jwksUpdated:      make(chan struct{}, 1),
 	}
 }
 
@@ -105,14 +116,25 @@ func (c *Client) close() {
 		c.conn.Close()
 		close(c.send)
 		close(c.done)
+		c.connected.Store(false)
+		metrics.SetConfigSyncConnected(false)
 		c.logger.Info("Connection closed and resources released")
 	})
 }
 
 func (c *Client) Start(ctx context.Context) error {
+	keys.OnJWKSUpdate(c.notifyJWKSUpdate)
+
 	backoff := CONNECTION_INITIAL_BACKOFF
+	connectionAttempted := false
 
 	for retries := 0; retries < CONNECTION_MAX_RETRIES; retries++ {
+		if connectionAttempted {
+			metrics.IncConfigSyncReconnects()
+		}
+
+		connectionAttempted = true
+
 		if retries > 0 {
 			time.Sleep(backoff)
 
@@ -134,6 +156,9 @@ func (c *Client) Start(ctx context.Context) error {
 
 		c.logger.Info("Successfully connected to tconfigd.")
 
+		c.connected.Store(true)
+		metrics.SetConfigSyncConnected(true)
+
 		c.done = make(chan struct{})
 		c.send = make(chan []byte, 256)
 
@@ -242,13 +267,29 @@ func (c *Client) connect(ctx context.Context) error {
 		return fmt.Errorf("received empty initial generation rules")
 	}
 
-	c.generationRules.UpdateCompleteRules(initialGenerationRulesResponsePayload.GenerationRules)
+	// Rejected rules are reported to tconfigd when it reconciles the rules, since their hash differs from its own.
+	if err := c.generationRules.UpdateCompleteRules(initialGenerationRulesResponsePayload.GenerationRules); err != nil {
+		c.logger.Error("Rejected invalid initial generation rules", zap.Error(err))
+	}
+
+	c.recordRulesUpdate()
+	c.initialRulesSet.Store(true)
 
 	c.logger.Info("Received and applied initial generation rules")
 
 	return nil
 }
 
+func (c *Client) IsConnected() bool {
+	return c.connected.Load()
+}
+
+// HasInitialRules reports whether the initial generation rules have been received from tconfigd. The rules are
+// kept while reconnecting.
+func (c *Client) HasInitialRules() bool {
+	return c.initialRulesSet.Load()
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.close()
@@ -300,6 +341,12 @@ func (c *Client) writePump() {
 			if err := c.writeMessage(websocket.TextMessage, message); err != nil {
 				c.logger.Error("Failed to write message.", zap.Error(err))
 
+				return
+			}
+		case <-c.jwksUpdated:
+			if err := c.pushJWKS(); err != nil {
+				c.logger.Error("Failed to push updated JWKS.", zap.Error(err))
+
 				return
 			}
 		case <-ticker.C:
@@ -330,6 +377,36 @@ func (c *Client) writePump() {
 	}
 }
 
+// notifyJWKSUpdate only flags the update, the write pump pushes the latest JWKS once it's connected.
+func (c *Client) notifyJWKSUpdate(_ jwk.Set) {
+	select {
+	case c.jwksUpdated <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Client) pushJWKS() error {
+	payload, err := json.Marshal(keys.GetJWKS())
+	if err != nil {
+		return fmt.Errorf("failed to marshal JWKS: %w", err)
+	}
+
+	request := Request{
+		ID:      uuid.NewString(),
+		Type:    MessageTypeJWKSUpdateRequest,
+		Payload: payload,
+	}
+
+	requestJSON, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JWKS update request: %w", err)
+	}
+
+	c.logger.Info("Pushing updated JWKS to tconfigd.", zap.String("request-id", request.ID))
+
+	return c.writeMessage(websocket.TextMessage, requestJSON)
+}
+
 func (c *Client) writeMessage(messageType int, data []byte) error {
 	c.conn.SetWriteDeadline(time.Now().Add(WRITE_WAIT))
 
@@ -354,6 +431,8 @@ func (c *Client) handleMessage(message []byte) {
 		MessageTypeRuleReconciliationRequest,
 		MessageTypeTraTDeletionRequest:
 		c.handleRequest(message)
+	case MessageTypeJWKSUpdateResponse:
+		c.handleJWKSUpdateResponse(message)
 	default:
 		c.logger.Error("Received unknown or unexpected message type.", zap.String("type", string(temp.Type)))
 	}
@@ -412,6 +491,15 @@ func (c *Client) handleRuleUpsertRequest(request Request) {
 			zap.Any("method", traTGenerationRule.Method))
 
 		err := c.generationRules.UpsertTraTRule(traTGenerationRule)
+
+		var validationError *v1alpha1.ValidationError
+		if errors.As(err, &validationError) {
+			c.logger.Error("Rejected invalid trat generation rule", zap.Error(err))
+			c.sendValidationErrorResponse(request.ID, MessageTypeTraTGenerationRuleUpsertResponse, validationError)
+
+			return
+		}
+
 		if err != nil {
 			c.logger.Error("Failed to upsert trat generation rule", zap.Error(err))
 			c.sendErrorResponse(
@@ -424,6 +512,8 @@ func (c *Client) handleRuleUpsertRequest(request Request) {
 			return
 		}
 
+		c.recordRulesUpdate()
+
 		err = c.sendResponse(request.ID, MessageTypeTraTGenerationRuleUpsertResponse, http.StatusOK, nil)
 		if err != nil {
 			c.logger.Error("Error sending trat generation upsert request response", zap.Error(err))
@@ -446,9 +536,31 @@ func (c *Client) handleRuleUpsertRequest(request Request) {
 
 		c.logger.Info("Received tokenetes config generation rule upsert request")
 
-		c.generationRules.UpdateTokenetesConfigRule(tokenetesConfigGenerationRule)
+		err := c.generationRules.UpdateTokenetesConfigRule(tokenetesConfigGenerationRule)
+
+		var validationError *v1alpha1.ValidationError
+		if errors.As(err, &validationError) {
+			c.logger.Error("Rejected invalid tokenetes config generation rule", zap.Error(err))
+			c.sendValidationErrorResponse(request.ID, MessageTypeTokenetesConfigGenerationRuleUpsertResponse, validationError)
+
+			return
+		}
+
+		if err != nil {
+			c.logger.Error("Failed to update tokenetes config generation rule", zap.Error(err))
+			c.sendErrorResponse(
+				request.ID,
+				MessageTypeTokenetesConfigGenerationRuleUpsertResponse,
+				http.StatusInternalServerError,
+				"error updating tokenetes config generation rule",
+			)
 
-		err := c.sendResponse(request.ID, MessageTypeTokenetesConfigGenerationRuleUpsertResponse, http.StatusOK, nil)
+			return
+		}
+
+		c.recordRulesUpdate()
+
+		err = c.sendResponse(request.ID, MessageTypeTokenetesConfigGenerationRuleUpsertResponse, http.StatusOK, nil)
 		if err != nil {
 			c.logger.Error("Error sending trat generation upsert request response", zap.Error(err))
 		}
@@ -473,6 +585,23 @@ func (c *Client) handleGetJWKSRequest(request Request) {
 	}
 }
 
+func (c *Client) handleJWKSUpdateResponse(message []byte) {
+	var response Response
+	if err := json.Unmarshal(message, &response); err != nil {
+		c.logger.Error("Failed to unmarshal JWKS update response", zap.Error(err))
+
+		return
+	}
+
+	if response.Status != http.StatusOK {
+		c.logger.Error("tconfigd rejected JWKS update.", zap.String("id", response.ID), zap.Int("status", response.Status), zap.ByteString("response", response.Payload))
+
+		return
+	}
+
+	c.logger.Debug("tconfigd accepted JWKS update.", zap.String("id", response.ID))
+}
+
 func (c *Client) handleRuleReconciliationRequest(request Request) {
 	c.logger.Info("Received generation rules reconciliation request")
 
@@ -490,9 +619,42 @@ func (c *Client) handleRuleReconciliationRequest(request Request) {
 		return
 	}
 
-	c.generationRules.UpdateCompleteRules(allActiveGenerationRules.GenerationRules)
+	if allActiveGenerationRules.GenerationRules == nil {
+		c.logger.Error("Received empty generation rules for reconciliation")
+		c.sendErrorResponse(
+			request.ID,
+			MessageTypeRuleReconciliationResponse,
+			http.StatusBadRequest,
+			"received empty generation rules",
+		)
+
+		return
+	}
+
+	err := c.generationRules.UpdateCompleteRules(allActiveGenerationRules.GenerationRules)
+	c.recordRulesUpdate()
+
+	var validationErrors v1alpha1.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		c.logger.Error("Rejected invalid generation rules during reconciliation", zap.Error(err))
+		c.sendValidationErrorsResponse(request.ID, MessageTypeRuleReconciliationResponse, validationErrors)
+
+		return
+	}
 
-	err := c.sendResponse(request.ID, MessageTypeRuleReconciliationResponse, http.StatusOK, nil)
+	if err != nil {
+		c.logger.Error("Failed to reconcile generation rules", zap.Error(err))
+		c.sendErrorResponse(
+			request.ID,
+			MessageTypeRuleReconciliationResponse,
+			http.StatusInternalServerError,
+			"error reconciling generation rules",
+		)
+
+		return
+	}
+
+	err = c.sendResponse(request.ID, MessageTypeRuleReconciliationResponse, http.StatusOK, nil)
 	if err != nil {
 		c.logger.Error("Error sending generation rule reconciliation request response", zap.Error(err))
 	}
@@ -516,6 +678,7 @@ func (c *Client) handleTraTDeletionRequest(request Request) {
 	}
 
 	c.generationRules.DeleteTrat(traTDeletionPayload.TraTName)
+	c.recordRulesUpdate()
 
 	err := c.sendResponse(request.ID, MessageTypeTraTDeletionResponse, http.StatusOK, nil)
 	if err != nil {
@@ -523,6 +686,17 @@ func (c *Client) handleTraTDeletionRequest(request Request) {
 	}
 }
 
+func (c *Client) recordRulesUpdate() {
+	ruleHash, err := c.generationRules.GetGenerationRulesHash()
+	if err != nil {
+		c.logger.Error("Error getting generation rule hash.", zap.Error(err))
+
+		return
+	}
+
+	metrics.SetRulesUpdated(ruleHash)
+}
+
 func (c *Client) sendResponse(id string, respType MessageType, status int, payload interface{}) error {
 	var payloadJSON json.RawMessage
 
@@ -555,6 +729,43 @@ func (c *Client) sendResponse(id string, respType MessageType, status int, paylo
 	}
 }
 
+// sendValidationErrorResponse sends the field-level errors of a rejected rule.
+func (c *Client) sendValidationErrorResponse(requestID string, messageType MessageType, validationError *v1alpha1.ValidationError) {
+	payload := struct {
+		Error       string                `json:"error"`
+		FieldErrors []v1alpha1.FieldError `json:"fieldErrors"`
+	}{
+		Error:       validationError.Error(),
+		FieldErrors: validationError.FieldErrors,
+	}
+
+	err := c.sendResponse(requestID, messageType, http.StatusBadRequest, payload)
+	if err != nil {
+		c.logger.Error("Failed to send validation error response",
+			zap.String("request-id", requestID),
+			zap.Error(err))
+	}
+}
+
+// sendValidationErrorsResponse sends the field-level errors of the rules rejected from a complete update. The
+// errors of the tokenetes config generation rule have no rule name.
+func (c *Client) sendValidationErrorsResponse(requestID string, messageType MessageType, validationErrors v1alpha1.ValidationErrors) {
+	payload := struct {
+		Error      string                      `json:"error"`
+		RuleErrors []*v1alpha1.ValidationError `json:"ruleErrors"`
+	}{
+		Error:      validationErrors.Error(),
+		RuleErrors: validationErrors,
+	}
+
+	err := c.sendResponse(requestID, messageType, http.StatusBadRequest, payload)
+	if err != nil {
+		c.logger.Error("Failed to send validation error response",
+			zap.String("request-id", requestID),
+			zap.Error(err))
+	}
+}
+
 func (c *Client) sendErrorResponse(requestID string, messageType MessageType, statusCode int, errorMessage string) {
 	err := c.sendResponse(requestID, messageType, statusCode, map[string]string{"error": errorMessage})
 	if err != nil {
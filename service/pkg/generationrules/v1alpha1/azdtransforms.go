@@ -0,0 +1,196 @@
+package v1alpha1
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	AZD_TRANSFORM_LOWERCASE = "lowercase"
+	AZD_TRANSFORM_CONCAT    = "concat"
+	AZD_TRANSFORM_CAST      = "cast"
+	AZD_TRANSFORM_LENGTH    = "length"
+	AZD_TRANSFORM_HASH      = "hash"
+)
+
+const (
+	AZD_CAST_STRING = "string"
+	AZD_CAST_INT    = "int"
+	AZD_CAST_NUMBER = "number"
+	AZD_CAST_BOOL   = "bool"
+)
+
+const (
+	AZD_HASH_SHA256 = "sha256"
+	AZD_HASH_SHA512 = "sha512"
+)
+
+// errAzdTransform is returned when an extracted value cannot be transformed, e.g. a non-numeric string cast to int.
+var errAzdTransform = errors.New("azd transform failed")
+
+// AzdTransform is applied to the value extracted for an azd field. The transforms of a field run in order.
+//
+//   - lowercase: lower-cases a string.
+//   - concat: appends Values, literals or ${...} paths resolved like the field value, joined with Separator.
+//   - cast: converts the value To string, int, number or bool.
+//   - length: replaces an array, object or string with its length.
+//   - hash: replaces the value with the hex Algorithm digest, sha256 by default, of its string form.
+type AzdTransform struct {
+	Type      string   `json:"type"`
+	Values    []string `json:"values,omitempty"`
+	Separator string   `json:"separator,omitempty"`
+	To        string   `json:"to,omitempty"`
+	Algorithm string   `json:"algorithm,omitempty"`
+}
+
+func (t AzdTransform) validate() error {
+	switch t.Type {
+	case AZD_TRANSFORM_LOWERCASE, AZD_TRANSFORM_LENGTH:
+		return nil
+	case AZD_TRANSFORM_CONCAT:
+		if len(t.Values) == 0 {
+			return errors.New("concat transform requires values")
+		}
+
+		return nil
+	case AZD_TRANSFORM_CAST:
+		switch t.To {
+		case AZD_CAST_STRING, AZD_CAST_INT, AZD_CAST_NUMBER, AZD_CAST_BOOL:
+			return nil
+		default:
+			return fmt.Errorf("unsupported cast target %q", t.To)
+		}
+	case AZD_TRANSFORM_HASH:
+		switch t.Algorithm {
+		case "", AZD_HASH_SHA256, AZD_HASH_SHA512:
+			return nil
+		default:
+			return fmt.Errorf("unsupported hash algorithm %q", t.Algorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported transform %q", t.Type)
+	}
+}
+
+// apply transforms value; resolve resolves the ${...} values of a concat transform.
+func (t AzdTransform) apply(value interface{}, resolve func(string) (interface{}, bool)) (interface{}, error) {
+	switch t.Type {
+	case AZD_TRANSFORM_LOWERCASE:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: lowercase requires a string, got %T", errAzdTransform, value)
+		}
+
+		return strings.ToLower(s), nil
+	case AZD_TRANSFORM_CONCAT:
+		parts := []string{stringify(value)}
+
+		for _, valueSpec := range t.Values {
+			part, ok := resolve(valueSpec)
+			if !ok {
+				return nil, fmt.Errorf("%w: failed to resolve concat value %s", errAzdTransform, valueSpec)
+			}
+
+			parts = append(parts, stringify(part))
+		}
+
+		return strings.Join(parts, t.Separator), nil
+	case AZD_TRANSFORM_CAST:
+		return cast(value, t.To)
+	case AZD_TRANSFORM_LENGTH:
+		switch v := value.(type) {
+		case []interface{}:
+			return len(v), nil
+		case map[string]interface{}:
+			return len(v), nil
+		case string:
+			return len(v), nil
+		default:
+			return nil, fmt.Errorf("%w: length requires an array, object or string, got %T", errAzdTransform, value)
+		}
+	case AZD_TRANSFORM_HASH:
+		data := []byte(stringify(value))
+
+		if t.Algorithm == AZD_HASH_SHA512 {
+			hash := sha512.Sum512(data)
+
+			return hex.EncodeToString(hash[:]), nil
+		}
+
+		hash := sha256.Sum256(data)
+
+		return hex.EncodeToString(hash[:]), nil
+	default:
+		return nil, fmt.Errorf("unsupported transform %q", t.Type)
+	}
+}
+
+func cast(value interface{}, to string) (interface{}, error) {
+	switch to {
+	case AZD_CAST_STRING:
+		return stringify(value), nil
+	case AZD_CAST_INT:
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("%w: %v is not an integer", errAzdTransform, v)
+			}
+
+			return int64(v), nil
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not an integer", errAzdTransform, v)
+			}
+
+			return i, nil
+		}
+	case AZD_CAST_NUMBER:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a number", errAzdTransform, v)
+			}
+
+			return f, nil
+		}
+	case AZD_CAST_BOOL:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a boolean", errAzdTransform, v)
+			}
+
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: cannot cast %T to %s", errAzdTransform, value, to)
+}
+
+// stringify returns strings as they are and the JSON encoding of any other value.
+func stringify(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,275 @@
+package v1alpha1
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+)
+
+func TestComputeAzd(t *testing.T) {
+	input := map[string]interface{}{
+		"request": map[string]interface{}{
+			"body": map[string]interface{}{
+				"name":    "Alice",
+				"amount":  42.0,
+				"ratio":   0.5,
+				"enabled": "true",
+				"count":   "7",
+				"price":   "9.99",
+				"tags":    []interface{}{"a", "b", "c"},
+				"note":    "hello",
+			},
+			"pathParameters": map[string]interface{}{
+				"account": "ACC-1",
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		field     AzdField
+		want      interface{}
+		wantEmpty bool
+		wantErr   error
+	}{
+		{
+			name:  "value from a path",
+			field: AzdField{Value: "${request.body.name}"},
+			want:  "Alice",
+		},
+		{
+			name:  "literal value",
+			field: AzdField{Value: "payments"},
+			want:  "payments",
+		},
+		{
+			name:    "missing required value",
+			field:   AzdField{Required: true, Value: "${request.body.missing}"},
+			wantErr: tokeneteserrors.ErrMissingRequiredAzdField,
+		},
+		{
+			name:  "missing optional value with a default",
+			field: AzdField{Value: "${request.body.missing}", Default: "none"},
+			want:  "none",
+		},
+		{
+			name:      "missing optional value without a default",
+			field:     AzdField{Value: "${request.body.missing}"},
+			wantEmpty: true,
+		},
+		{
+			name: "defaults are not transformed",
+			field: AzdField{
+				Value:     "${request.body.missing}",
+				Default:   "NONE",
+				Transform: []AzdTransform{{Type: AZD_TRANSFORM_LOWERCASE}},
+			},
+			want: "NONE",
+		},
+		{
+			name:  "lowercase",
+			field: AzdField{Value: "${request.body.name}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_LOWERCASE}}},
+			want:  "alice",
+		},
+		{
+			name:    "lowercase of a number",
+			field:   AzdField{Value: "${request.body.amount}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_LOWERCASE}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name: "concat of paths and literals",
+			field: AzdField{
+				Value:     "${request.pathParameters.account}",
+				Transform: []AzdTransform{{Type: AZD_TRANSFORM_CONCAT, Values: []string{"${request.body.name}", "${request.body.amount}", "end"}, Separator: ":"}},
+			},
+			want: "ACC-1:Alice:42:end",
+		},
+		{
+			name: "concat with a missing path",
+			field: AzdField{
+				Value:     "${request.pathParameters.account}",
+				Transform: []AzdTransform{{Type: AZD_TRANSFORM_CONCAT, Values: []string{"${request.body.missing}"}}},
+			},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:  "cast a number to a string",
+			field: AzdField{Value: "${request.body.amount}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_STRING}}},
+			want:  "42",
+		},
+		{
+			name:  "cast an array to a string",
+			field: AzdField{Value: "${request.body.tags}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_STRING}}},
+			want:  `["a","b","c"]`,
+		},
+		{
+			name:  "cast a whole number to an int",
+			field: AzdField{Value: "${request.body.amount}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_INT}}},
+			want:  int64(42),
+		},
+		{
+			name:  "cast a string to an int",
+			field: AzdField{Value: "${request.body.count}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_INT}}},
+			want:  int64(7),
+		},
+		{
+			name:    "cast a fraction to an int",
+			field:   AzdField{Value: "${request.body.ratio}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_INT}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:    "cast a non-numeric string to an int",
+			field:   AzdField{Value: "${request.body.name}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_INT}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:  "cast a string to a number",
+			field: AzdField{Value: "${request.body.price}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_NUMBER}}},
+			want:  9.99,
+		},
+		{
+			name:    "cast an array to a number",
+			field:   AzdField{Value: "${request.body.tags}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_NUMBER}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:  "cast a string to a bool",
+			field: AzdField{Value: "${request.body.enabled}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_BOOL}}},
+			want:  true,
+		},
+		{
+			name:    "cast a non-boolean string to a bool",
+			field:   AzdField{Value: "${request.body.note}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_BOOL}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:  "length of an array",
+			field: AzdField{Value: "${request.body.tags}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_LENGTH}}},
+			want:  3,
+		},
+		{
+			name:  "length of a string",
+			field: AzdField{Value: "${request.body.note}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_LENGTH}}},
+			want:  5,
+		},
+		{
+			name:    "length of a number",
+			field:   AzdField{Value: "${request.body.amount}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_LENGTH}}},
+			wantErr: tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:  "sha256 hash by default",
+			field: AzdField{Value: "${request.body.name}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_HASH}}},
+			want:  "3bc51062973c458d5a6f2d8d64a023246354ad7e064b1e4e009ec8a0699a3043",
+		},
+		{
+			name:  "sha512 hash",
+			field: AzdField{Value: "${request.body.name}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_HASH, Algorithm: AZD_HASH_SHA512}}},
+			want:  "299403b3d6b5c6244fc0ec6f278cb8c233734f0c156c6b8c214341fd6f8f7c781b9b2a137a09329032b9d58e8a37060690521a7d93631d43699efce8106085c9",
+		},
+		{
+			name:  "hash of a number uses its JSON form",
+			field: AzdField{Value: "${request.body.amount}", Transform: []AzdTransform{{Type: AZD_TRANSFORM_HASH, Algorithm: AZD_HASH_SHA256}}},
+			want:  "73475cb40a568e8da8a045ced110137e159f890ac4da883b6b17dc651b3a8049",
+		},
+		{
+			name: "transforms run in order",
+			field: AzdField{
+				Value: "${request.body.name}",
+				Transform: []AzdTransform{
+					{Type: AZD_TRANSFORM_LOWERCASE},
+					{Type: AZD_TRANSFORM_CONCAT, Values: []string{"${request.pathParameters.account}"}, Separator: "@"},
+					{Type: AZD_TRANSFORM_LENGTH},
+				},
+			},
+			want: len("alice@ACC-1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			azd, err := computeAzd(AzdMapping{"field": tt.field}, input)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("computeAzd() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("computeAzd() error = %v", err)
+			}
+
+			value, ok := azd["field"]
+
+			if tt.wantEmpty {
+				if ok {
+					t.Errorf("computeAzd() field = %v, want it omitted", value)
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(value, tt.want) {
+				t.Errorf("computeAzd() field = %#v, want %#v", value, tt.want)
+			}
+		})
+	}
+}
+
+func TestAzdTransformValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform AzdTransform
+		wantErr   bool
+	}{
+		{
+			name:      "lowercase",
+			transform: AzdTransform{Type: AZD_TRANSFORM_LOWERCASE},
+		},
+		{
+			name:      "concat with values",
+			transform: AzdTransform{Type: AZD_TRANSFORM_CONCAT, Values: []string{"${request.body.name}"}},
+		},
+		{
+			name:      "concat without values",
+			transform: AzdTransform{Type: AZD_TRANSFORM_CONCAT},
+			wantErr:   true,
+		},
+		{
+			name:      "cast to a supported type",
+			transform: AzdTransform{Type: AZD_TRANSFORM_CAST, To: AZD_CAST_NUMBER},
+		},
+		{
+			name:      "cast to an unsupported type",
+			transform: AzdTransform{Type: AZD_TRANSFORM_CAST, To: "date"},
+			wantErr:   true,
+		},
+		{
+			name:      "hash with the default algorithm",
+			transform: AzdTransform{Type: AZD_TRANSFORM_HASH},
+		},
+		{
+			name:      "hash with an unsupported algorithm",
+			transform: AzdTransform{Type: AZD_TRANSFORM_HASH, Algorithm: "md5"},
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported transform",
+			transform: AzdTransform{Type: "uppercase"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.transform.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
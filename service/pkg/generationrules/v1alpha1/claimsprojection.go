@@ -0,0 +1,201 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/tokenetes/tokenetes/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_PROJECTED_CLAIMS_NAME = "sctx"
+	// DEFAULT_MAX_PROJECTED_CLAIM_SIZE and DEFAULT_MAX_PROJECTED_CLAIMS_SIZE bound, in bytes of JSON, each projected
+	// claim and the namespaced claim holding them, so that large subject tokens do not bloat every txn token.
+	DEFAULT_MAX_PROJECTED_CLAIM_SIZE  = 1024
+	DEFAULT_MAX_PROJECTED_CLAIMS_SIZE = 4096
+)
+
+// reservedTxnTokenClaims cannot be used as the namespaced claim of projected subject token claims.
+var reservedTxnTokenClaims = map[string]bool{
+	"iss": true, "iat": true, "aud": true, "exp": true, "txn": true, "sub": true,
+	"purp": true, "azd": true, "rctx": true, "tctx": true, "parent": true, "trace_id": true,
+}
+
+// ClaimsProjection copies subject token claims into a namespaced claim of the txn token. Claims maps each projected
+// claim name to a JSON path over the verified subject token claims, e.g. {"tenant": "tid", "roles": "realm_access.roles"}.
+// Claims missing from the subject token and claims larger than MaxClaimSize are left out; claims are then dropped in
+// name order once MaxSize is reached. For txn subject tokens the paths apply to the subject txn token, so a
+// replacement token keeps a projected claim with a path such as "sctx.tenant".
+type ClaimsProjection struct {
+	Name         string            `json:"name,omitempty"`
+	Claims       map[string]string `json:"claims"`
+	MaxClaimSize int               `json:"maxClaimSize,omitempty"`
+	MaxSize      int               `json:"maxSize,omitempty"`
+}
+
+// IsReservedTxnTokenClaim reports whether the claim is one of the txn token's own claims, as opposed to a
+// namespaced claim of projected subject token claims.
+func IsReservedTxnTokenClaim(claim string) bool {
+	return reservedTxnTokenClaims[claim]
+}
+
+func (p *ClaimsProjection) name() string {
+	if p.Name == "" {
+		return DEFAULT_PROJECTED_CLAIMS_NAME
+	}
+
+	return p.Name
+}
+
+func (p *ClaimsProjection) validate(v *validator, field string) {
+	if reservedTxnTokenClaims[p.name()] {
+		v.add(field+".name", "%s is a reserved txn token claim", p.name())
+	}
+
+	for claim, claimPath := range p.Claims {
+		if claim == "" {
+			v.add(field+".claims", "claim name must not be empty")
+		}
+
+		if claimPath == "" {
+			v.add(field+".claims."+claim, "JSON path must not be empty")
+		}
+	}
+
+	if p.MaxClaimSize < 0 {
+		v.add(field+".maxClaimSize", "must not be negative")
+	}
+
+	if p.MaxSize < 0 {
+		v.add(field+".maxSize", "must not be negative")
+	}
+}
+
+// mergeClaimsProjections returns the projection of a request. The projection of the rule matching the request
+// extends the namespace projection; the rule's name and size limits take precedence.
+func mergeClaimsProjections(namespaceProjection, ruleProjection *ClaimsProjection) *ClaimsProjection {
+	if namespaceProjection == nil || ruleProjection == nil {
+		if namespaceProjection != nil {
+			return namespaceProjection
+		}
+
+		return ruleProjection
+	}
+
+	projection := &ClaimsProjection{
+		Name:         namespaceProjection.Name,
+		Claims:       make(map[string]string, len(namespaceProjection.Claims)+len(ruleProjection.Claims)),
+		MaxClaimSize: namespaceProjection.MaxClaimSize,
+		MaxSize:      namespaceProjection.MaxSize,
+	}
+
+	for claim, claimPath := range namespaceProjection.Claims {
+		projection.Claims[claim] = claimPath
+	}
+
+	for claim, claimPath := range ruleProjection.Claims {
+		projection.Claims[claim] = claimPath
+	}
+
+	if ruleProjection.Name != "" {
+		projection.Name = ruleProjection.Name
+	}
+
+	if ruleProjection.MaxClaimSize != 0 {
+		projection.MaxClaimSize = ruleProjection.MaxClaimSize
+	}
+
+	if ruleProjection.MaxSize != 0 {
+		projection.MaxSize = ruleProjection.MaxSize
+	}
+
+	return projection
+}
+
+// ProjectSubjectClaims returns the name of the namespaced txn token claim and the subject token claims projected
+// into it. It returns no claims if no projection is configured for the request.
+func (mr *MatchedRequest) ProjectSubjectClaims(subjectTokenClaims interface{}) (string, map[string]interface{}, error) {
+	projection := mr.claimsProjection
+	if projection == nil || len(projection.Claims) == 0 {
+		return "", nil, nil
+	}
+
+	claims, ok := subjectTokenClaims.(jwt.MapClaims)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported subject token claims type %T", subjectTokenClaims)
+	}
+
+	jsonClaims, err := marshalToJson(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal subject token claims to JSON: %w", err)
+	}
+
+	maxClaimSize := projection.MaxClaimSize
+	if maxClaimSize == 0 {
+		maxClaimSize = DEFAULT_MAX_PROJECTED_CLAIM_SIZE
+	}
+
+	maxSize := projection.MaxSize
+	if maxSize == 0 {
+		maxSize = DEFAULT_MAX_PROJECTED_CLAIMS_SIZE
+	}
+
+	projectedClaimNames := make([]string, 0, len(projection.Claims))
+	for claim := range projection.Claims {
+		projectedClaimNames = append(projectedClaimNames, claim)
+	}
+
+	sort.Strings(projectedClaimNames)
+
+	logger := logging.GetLogger("generation-rules")
+
+	projectedClaims := make(map[string]interface{})
+	size := len("{}")
+
+	for _, claim := range projectedClaimNames {
+		value := extractValueFromJson(jsonClaims, projection.Claims[claim])
+		if value == nil {
+			continue
+		}
+
+		jsonValue, err := json.Marshal(value)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal projected claim %s: %w", claim, err)
+		}
+
+		if len(jsonValue) > maxClaimSize {
+			logger.Warn("Projected subject token claim exceeds the size limit; leaving it out.",
+				zap.String("claim", claim),
+				zap.Int("size", len(jsonValue)),
+				zap.Int("max-size", maxClaimSize))
+
+			continue
+		}
+
+		// The claim name is quoted and followed by a colon, and every claim but the first is preceded by a comma.
+		claimSize := len(claim) + len(`"":`) + len(jsonValue)
+		if len(projectedClaims) > 0 {
+			claimSize++
+		}
+
+		if size+claimSize > maxSize {
+			logger.Warn("Projected subject token claims exceed the size limit; leaving a claim out.",
+				zap.String("claim", claim),
+				zap.Int("max-size", maxSize))
+
+			continue
+		}
+
+		size += claimSize
+		projectedClaims[claim] = value
+	}
+
+	if len(projectedClaims) == 0 {
+		return "", nil, nil
+	}
+
+	return projection.name(), projectedClaims, nil
+}
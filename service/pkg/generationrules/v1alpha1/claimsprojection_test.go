@@ -0,0 +1,136 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestProjectSubjectClaims(t *testing.T) {
+	subjectTokenClaims := jwt.MapClaims{
+		"sub": "alice",
+		"tid": "tenant-1",
+		"realm_access": map[string]interface{}{
+			"roles": []interface{}{"viewer", "admin"},
+		},
+		"org": map[string]interface{}{
+			"department": map[string]interface{}{"id": 42},
+		},
+		"profile": strings.Repeat("x", 2000),
+	}
+
+	tests := []struct {
+		name                string
+		namespaceProjection *ClaimsProjection
+		ruleProjection      *ClaimsProjection
+		subjectTokenClaims  interface{}
+		wantName            string
+		want                map[string]interface{}
+		wantErr             bool
+	}{
+		{
+			name: "no projection",
+		},
+		{
+			name:                "namespace projection",
+			namespaceProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid"}},
+			wantName:            DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:                map[string]interface{}{"tenant": "tenant-1"},
+		},
+		{
+			name:           "rule projection",
+			ruleProjection: &ClaimsProjection{Name: "ctx", Claims: map[string]string{"roles": "realm_access.roles"}},
+			wantName:       "ctx",
+			want:           map[string]interface{}{"roles": []interface{}{"viewer", "admin"}},
+		},
+		{
+			name:                "rule projection extends the namespace projection",
+			namespaceProjection: &ClaimsProjection{Name: "sctx", Claims: map[string]string{"tenant": "tid", "subject": "sub"}},
+			ruleProjection:      &ClaimsProjection{Name: "payments", Claims: map[string]string{"subject": "org.department.id", "roles": "realm_access.roles"}},
+			wantName:            "payments",
+			want: map[string]interface{}{
+				"tenant":  "tenant-1",
+				"subject": float64(42),
+				"roles":   []interface{}{"viewer", "admin"},
+			},
+		},
+		{
+			name:           "nested paths",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"department": "org.department.id", "first_role": "realm_access.roles.0", "org": "org"}},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want: map[string]interface{}{
+				"department": float64(42),
+				"first_role": "viewer",
+				"org":        map[string]interface{}{"department": map[string]interface{}{"id": float64(42)}},
+			},
+		},
+		{
+			name:           "missing paths are left out",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid", "email": "email", "team": "org.team.id"}},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:           map[string]interface{}{"tenant": "tenant-1"},
+		},
+		{
+			name:           "only missing paths",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"email": "email"}},
+		},
+		{
+			name:           "claim over the default claim size limit is left out",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid", "profile": "profile"}},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:           map[string]interface{}{"tenant": "tenant-1"},
+		},
+		{
+			name:           "claim over a configured claim size limit is left out",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid", "roles": "realm_access.roles"}, MaxClaimSize: len(`"tenant-1"`)},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:           map[string]interface{}{"tenant": "tenant-1"},
+		},
+		{
+			// {"roles":["viewer","admin"]} is 28 bytes; adding ,"tenant":"tenant-1" would take it to 48.
+			name:           "claims over the total size limit are dropped in name order",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid", "roles": "realm_access.roles"}, MaxSize: 47},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:           map[string]interface{}{"roles": []interface{}{"viewer", "admin"}},
+		},
+		{
+			name:           "claims exactly at the total size limit",
+			ruleProjection: &ClaimsProjection{Claims: map[string]string{"tenant": "tid", "roles": "realm_access.roles"}, MaxSize: 48},
+			wantName:       DEFAULT_PROJECTED_CLAIMS_NAME,
+			want:           map[string]interface{}{"roles": []interface{}{"viewer", "admin"}, "tenant": "tenant-1"},
+		},
+		{
+			name:               "unsupported subject token claims",
+			ruleProjection:     &ClaimsProjection{Claims: map[string]string{"tenant": "tid"}},
+			subjectTokenClaims: map[string]interface{}{"tid": "tenant-1"},
+			wantErr:            true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchedRequest := &MatchedRequest{claimsProjection: mergeClaimsProjections(tt.namespaceProjection, tt.ruleProjection)}
+
+			claims := tt.subjectTokenClaims
+			if claims == nil {
+				claims = subjectTokenClaims
+			}
+
+			name, projectedClaims, err := matchedRequest.ProjectSubjectClaims(claims)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProjectSubjectClaims() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if name != tt.wantName {
+				t.Errorf("ProjectSubjectClaims() name = %q, want %q", name, tt.wantName)
+			}
+
+			if !reflect.DeepEqual(projectedClaims, tt.want) {
+				t.Errorf("ProjectSubjectClaims() = %v, want %v", projectedClaims, tt.want)
+			}
+		})
+	}
+}
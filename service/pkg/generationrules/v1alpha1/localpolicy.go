@@ -0,0 +1,112 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/tokenetes/tokenetes/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// LOCAL_POLICY_COMBINE_AND grants access if both the local policy and the access evaluation api do. It is the
+	// default.
+	LOCAL_POLICY_COMBINE_AND = "and"
+	// LOCAL_POLICY_COMBINE_OR grants access if either the local policy or the access evaluation api does.
+	LOCAL_POLICY_COMBINE_OR = "or"
+)
+
+// localPolicyVariables are the top-level fields of the access evaluation input document. Path parameters are
+// declared in addition, under their names.
+var localPolicyVariables = []string{"body", "headers", "queryParameters", "subject_token", "request_details", "request_context"}
+
+// LocalPolicy is a CEL expression evaluated in-process over the access evaluation input document, e.g.
+// "subject_token.tid == tenant" or "body.amount < 1000 || 'admin' in subject_token.roles". The access evaluation
+// api is not called when the local decision settles the combined decision.
+type LocalPolicy struct {
+	Expression string `json:"expression"`
+	Combine    string `json:"combine,omitempty"`
+
+	program cel.Program
+}
+
+// compile compiles the expression once; the program is shared by the copies of the rule.
+func (p *LocalPolicy) compile(parameterNames []string) error {
+	if p.program != nil {
+		return nil
+	}
+
+	options := []cel.EnvOption{cel.CrossTypeNumericComparisons(true)}
+
+	for _, name := range append(localPolicyVariables, parameterNames...) {
+		options = append(options, cel.Variable(name, cel.DynType))
+	}
+
+	env, err := cel.NewEnv(options...)
+	if err != nil {
+		return fmt.Errorf("error creating CEL environment: %w", err)
+	}
+
+	ast, issues := env.Compile(p.Expression)
+	if issues != nil && issues.Err() != nil {
+		return issues.Err()
+	}
+
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return fmt.Errorf("expression must evaluate to a bool, not %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return fmt.Errorf("error creating CEL program: %w", err)
+	}
+
+	p.program = program
+
+	return nil
+}
+
+func (p *LocalPolicy) combine() string {
+	if p.Combine == "" {
+		return LOCAL_POLICY_COMBINE_AND
+	}
+
+	return p.Combine
+}
+
+// evaluate evaluates the policy over the input document, which is converted to JSON types first.
+func (p *LocalPolicy) evaluate(input map[string]interface{}) (bool, error) {
+	if p.program == nil {
+		return false, fmt.Errorf("local policy %q is not compiled", p.Expression)
+	}
+
+	jsonInput, err := json.Marshal(input)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal local policy input to JSON: %w", err)
+	}
+
+	var activation map[string]interface{}
+
+	if err := json.Unmarshal(jsonInput, &activation); err != nil {
+		return false, fmt.Errorf("failed to unmarshal local policy input: %w", err)
+	}
+
+	// Evaluation errors, such as a field missing from the request, deny access rather than exposing the policy to
+	// the caller.
+	result, _, err := p.program.Eval(activation)
+	if err != nil {
+		logging.GetLogger("generation-rules").Warn("Local policy evaluation failed; denying access.",
+			zap.String("expression", p.Expression),
+			zap.Error(err))
+
+		return false, nil
+	}
+
+	decision, ok := result.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("local policy evaluated to %T, not a bool", result.Value())
+	}
+
+	return decision, nil
+}
@@ -0,0 +1,248 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"go.uber.org/zap"
+)
+
+func TestLocalPolicyEvaluate(t *testing.T) {
+	subjectTokenClaims := map[string]interface{}{
+		"sub":   "alice",
+		"tid":   "tenant-1",
+		"roles": []interface{}{"viewer", "admin"},
+	}
+
+	requestDetails := common.RequestDetails{
+		Path:   "/tenants/tenant-1/transfers",
+		Method: common.Post,
+		Body:   json.RawMessage(`{"amount": 250, "currency": "EUR"}`),
+	}
+
+	pathParameter := map[string]interface{}{"tenant": "tenant-1"}
+
+	tests := []struct {
+		name           string
+		expression     string
+		want           bool
+		wantCompileErr bool
+		wantErr        bool
+	}{
+		{
+			name:       "subject token claim compared with a path parameter",
+			expression: "subject_token.tid == tenant",
+			want:       true,
+		},
+		{
+			name:       "body number compared with an int",
+			expression: "body.amount < 1000",
+			want:       true,
+		},
+		{
+			name:       "body number over the limit",
+			expression: "body.amount < 100",
+			want:       false,
+		},
+		{
+			name:       "membership in a claim list",
+			expression: "'admin' in subject_token.roles",
+			want:       true,
+		},
+		{
+			name:       "request details",
+			expression: "request_details.method == 'POST' && request_details.path.startsWith('/tenants/')",
+			want:       true,
+		},
+		{
+			name:       "missing field denies access",
+			expression: "body.limit > 0",
+			want:       false,
+		},
+		{
+			name:       "type error denies access",
+			expression: "body.currency > 1",
+			want:       false,
+		},
+		{
+			name:       "dynamic result that is not a bool",
+			expression: "body.currency",
+			wantErr:    true,
+		},
+		{
+			name:           "result that is not a bool",
+			expression:     "1 + 2",
+			wantCompileErr: true,
+		},
+		{
+			name:           "undeclared variable",
+			expression:     "account == 'a'",
+			wantCompileErr: true,
+		},
+		{
+			name:           "syntax error",
+			expression:     "body.amount <",
+			wantCompileErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localPolicy := &LocalPolicy{Expression: tt.expression}
+
+			err := localPolicy.compile([]string{"tenant"})
+			if (err != nil) != tt.wantCompileErr {
+				t.Fatalf("compile() error = %v, want error %v", err, tt.wantCompileErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			decision, err := localPolicy.evaluate(accessevaluation.NewInput(subjectTokenClaims, requestDetails, nil, pathParameter))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluate() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if decision != tt.want {
+				t.Errorf("evaluate() = %v, want %v", decision, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchedRequestEvaluateAccessWithLocalPolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		combine           string
+		localDecision     bool
+		remoteDecision    bool
+		remoteDisabled    bool
+		want              bool
+		wantRemoteCalls   int
+		withoutEvaluation bool
+	}{
+		{
+			name:            "and: local deny settles the decision",
+			combine:         LOCAL_POLICY_COMBINE_AND,
+			localDecision:   false,
+			remoteDecision:  true,
+			want:            false,
+			wantRemoteCalls: 0,
+		},
+		{
+			name:            "and: local permit defers to the api permit",
+			combine:         LOCAL_POLICY_COMBINE_AND,
+			localDecision:   true,
+			remoteDecision:  true,
+			want:            true,
+			wantRemoteCalls: 1,
+		},
+		{
+			name:            "and: local permit defers to the api deny",
+			combine:         LOCAL_POLICY_COMBINE_AND,
+			localDecision:   true,
+			remoteDecision:  false,
+			want:            false,
+			wantRemoteCalls: 1,
+		},
+		{
+			name:            "and is the default",
+			localDecision:   false,
+			remoteDecision:  true,
+			want:            false,
+			wantRemoteCalls: 0,
+		},
+		{
+			name:            "or: local permit settles the decision",
+			combine:         LOCAL_POLICY_COMBINE_OR,
+			localDecision:   true,
+			remoteDecision:  false,
+			want:            true,
+			wantRemoteCalls: 0,
+		},
+		{
+			name:            "or: local deny defers to the api permit",
+			combine:         LOCAL_POLICY_COMBINE_OR,
+			localDecision:   false,
+			remoteDecision:  true,
+			want:            true,
+			wantRemoteCalls: 1,
+		},
+		{
+			name:            "or: local deny defers to the api deny",
+			combine:         LOCAL_POLICY_COMBINE_OR,
+			localDecision:   false,
+			remoteDecision:  false,
+			want:            false,
+			wantRemoteCalls: 1,
+		},
+		{
+			name:           "local policy alone while the api is disabled",
+			combine:        LOCAL_POLICY_COMBINE_OR,
+			localDecision:  false,
+			remoteDecision: true,
+			remoteDisabled: true,
+			want:           false,
+		},
+		{
+			name:              "local policy alone for a rule without an access evaluation mapping",
+			localDecision:     true,
+			remoteDecision:    false,
+			withoutEvaluation: true,
+			want:              true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteCalls := 0
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteCalls++
+
+				fmt.Fprintf(w, `{"decision": %t}`, tt.remoteDecision)
+			}))
+			defer server.Close()
+
+			rule := newTestRule("transfer", common.Post, "/transfers")
+			rule.LocalPolicy = &LocalPolicy{Expression: fmt.Sprintf("%t", tt.localDecision), Combine: tt.combine}
+
+			if !tt.withoutEvaluation {
+				rule.AccessEvaluation = &DynamicMap{Map: map[string]interface{}{"subject": "${subject_token.sub}"}}
+			}
+
+			if err := rule.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			matchedRequest := &MatchedRequest{
+				txnTokenRequest: &common.TokenRequest{RequestDetails: common.RequestDetails{Path: "/transfers", Method: common.Post}},
+				rule:            rule,
+				accessEvaluator: accessevaluation.NewAccessEvaluator(accessevaluation.AccessEvaluationAPI{
+					Endpoint:               server.URL,
+					EnableAccessEvaluation: !tt.remoteDisabled,
+				}, server.Client(), zap.NewNop()),
+			}
+
+			decision, err := matchedRequest.EvaluateAccess(context.Background(), map[string]interface{}{"sub": "alice"}, rule.Purp)
+			if err != nil {
+				t.Fatalf("EvaluateAccess() error = %v", err)
+			}
+
+			if decision != tt.want {
+				t.Errorf("EvaluateAccess() = %v, want %v", decision, tt.want)
+			}
+
+			if remoteCalls != tt.wantRemoteCalls {
+				t.Errorf("access evaluation api calls = %d, want %d", remoteCalls, tt.wantRemoteCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+// MatchConditions narrow a trat generation rule to the requests carrying the given query parameter and header
+// values, for endpoints that multiplex operations, e.g. POST /rpc?action=transfer. Header names are case-insensitive.
+type MatchConditions struct {
+	QueryParameters map[string]string `json:"queryParameters,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+}
+
+// specificity is the number of conditions; among the rules of a path and method the most specific matching one wins.
+func (m *MatchConditions) specificity() int {
+	if m == nil {
+		return 0
+	}
+
+	return len(m.QueryParameters) + len(m.Headers)
+}
+
+// isDisjointWith reports whether no request can satisfy both m and other, i.e. they require different values for
+// the same query parameter or header.
+func (m *MatchConditions) isDisjointWith(other *MatchConditions) bool {
+	if m == nil || other == nil {
+		return false
+	}
+
+	for name, value := range m.QueryParameters {
+		if otherValue, ok := other.QueryParameters[name]; ok && otherValue != value {
+			return true
+		}
+	}
+
+	otherHeaders := make(map[string]string, len(other.Headers))
+	for name, value := range other.Headers {
+		otherHeaders[strings.ToLower(name)] = value
+	}
+
+	for name, value := range m.Headers {
+		if otherValue, ok := otherHeaders[strings.ToLower(name)]; ok && otherValue != value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *MatchConditions) String() string {
+	if m == nil {
+		return "{}"
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("%v", *m)
+	}
+
+	return string(data)
+}
+
+// matches reports whether the request satisfies the conditions. A conditioned query parameter or header with
+// several values could satisfy rules that are disjoint, so it matches no rule and is recorded in the request as
+// multiValued, for the request to be rejected.
+func (m *MatchConditions) matches(request *requestAttributes) bool {
+	if m == nil {
+		return true
+	}
+
+	matches := true
+
+	for name, value := range m.QueryParameters {
+		values := request.queryParameters[name]
+		if len(values) > 1 {
+			request.multiValued = "query parameter " + name
+		}
+
+		if len(values) != 1 || values[0] != value {
+			matches = false
+		}
+	}
+
+	for name, value := range m.Headers {
+		values := request.headers[strings.ToLower(name)]
+		if len(values) > 1 {
+			request.multiValued = "header " + strings.ToLower(name)
+		}
+
+		if len(values) != 1 || values[0] != value {
+			matches = false
+		}
+	}
+
+	return matches
+}
+
+// requestAttributes holds the query parameter and header values of a request, as sent in the request details either
+// as single values or as arrays of values. Header names are lower-cased.
+type requestAttributes struct {
+	queryParameters map[string][]string
+	headers         map[string][]string
+	// multiValued names a conditioned query parameter or header the request has several values for.
+	multiValued string
+}
+
+func newRequestAttributes(requestDetails common.RequestDetails) *requestAttributes {
+	return &requestAttributes{
+		queryParameters: parseRequestValues(requestDetails.QueryParameters, false),
+		headers:         parseRequestValues(requestDetails.Headers, true),
+	}
+}
+
+// parseRequestValues ignores values that are not a JSON object, so that a rule with match conditions simply does not
+// match them.
+func parseRequestValues(data json.RawMessage, lowerCaseNames bool) map[string][]string {
+	values := make(map[string][]string)
+
+	if len(data) == 0 {
+		return values
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return values
+	}
+
+	for name, value := range raw {
+		if lowerCaseNames {
+			name = strings.ToLower(name)
+		}
+
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				values[name] = append(values[name], fmt.Sprint(item))
+			}
+		case nil:
+		default:
+			values[name] = append(values[name], fmt.Sprint(v))
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,191 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+)
+
+func newTestRuleWithMatch(traTName string, match *MatchConditions) TraTGenerationRule {
+	rule := newTestRule(traTName, common.Post, "/rpc")
+	rule.Match = match
+
+	return *rule
+}
+
+func TestMatchRuleWithMatchConditions(t *testing.T) {
+	rules := []TraTGenerationRule{
+		newTestRuleWithMatch("rpc", nil),
+		newTestRuleWithMatch("transfer", &MatchConditions{QueryParameters: map[string]string{"action": "transfer"}}),
+		newTestRuleWithMatch("read", &MatchConditions{QueryParameters: map[string]string{"action": "read"}}),
+		newTestRuleWithMatch("read-v2", &MatchConditions{
+			QueryParameters: map[string]string{"action": "read"},
+			Headers:         map[string]string{"X-Api-Version": "2"},
+		}),
+	}
+
+	tests := []struct {
+		name            string
+		queryParameters string
+		headers         string
+		wantTraTName    string
+		wantErr         error
+	}{
+		{
+			name:         "rule without match conditions",
+			wantTraTName: "rpc",
+		},
+		{
+			name:            "query parameter condition",
+			queryParameters: `{"action": "transfer"}`,
+			wantTraTName:    "transfer",
+		},
+		{
+			name:            "query parameter value sent as an array",
+			queryParameters: `{"action": ["transfer"]}`,
+			wantTraTName:    "transfer",
+		},
+		{
+			name:            "unknown value falls back to the less specific rule",
+			queryParameters: `{"action": "delete"}`,
+			wantTraTName:    "rpc",
+		},
+		{
+			name:            "more specific rule wins",
+			queryParameters: `{"action": "read"}`,
+			headers:         `{"x-api-version": "2"}`,
+			wantTraTName:    "read-v2",
+		},
+		{
+			name:            "header names are case-insensitive",
+			queryParameters: `{"action": "read"}`,
+			headers:         `{"X-API-VERSION": "2"}`,
+			wantTraTName:    "read-v2",
+		},
+		{
+			name:            "conditions are only met together",
+			queryParameters: `{"action": "read"}`,
+			headers:         `{"x-api-version": "1"}`,
+			wantTraTName:    "read",
+		},
+		{
+			name:            "several values for a conditioned query parameter",
+			queryParameters: `{"action": ["read", "transfer"]}`,
+			wantErr:         tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:            "several values for a conditioned header",
+			queryParameters: `{"action": "read"}`,
+			headers:         `{"x-api-version": ["1", "2"]}`,
+			wantErr:         tokeneteserrors.ErrInvalidRequestDetails,
+		},
+		{
+			name:            "several values for a parameter no rule is conditioned on",
+			queryParameters: `{"action": "transfer", "tag": ["a", "b"]}`,
+			wantTraTName:    "transfer",
+		},
+	}
+
+	gri := NewGenerationRulesImp(nil, false)
+
+	for _, rule := range rules {
+		if err := gri.UpsertTraTRule(rule); err != nil {
+			t.Fatalf("UpsertTraTRule(%s) error = %v", rule.TraTName, err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestDetails := common.RequestDetails{Path: "/rpc", Method: common.Post}
+
+			if tt.queryParameters != "" {
+				requestDetails.QueryParameters = json.RawMessage(tt.queryParameters)
+			}
+
+			if tt.headers != "" {
+				requestDetails.Headers = json.RawMessage(tt.headers)
+			}
+
+			rule, _, err := gri.matchRule(requestDetails)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("matchRule() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("matchRule() error = %v", err)
+			}
+
+			if rule.TraTName != tt.wantTraTName {
+				t.Errorf("matchRule() matched %s, want %s", rule.TraTName, tt.wantTraTName)
+			}
+		})
+	}
+}
+
+func TestMatchConditionsConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *MatchConditions
+		match    *MatchConditions
+		wantErr  bool
+	}{
+		{
+			name:     "different values for the same query parameter",
+			existing: &MatchConditions{QueryParameters: map[string]string{"action": "read"}},
+			match:    &MatchConditions{QueryParameters: map[string]string{"action": "transfer"}},
+		},
+		{
+			name:     "different values for the same header in another case",
+			existing: &MatchConditions{Headers: map[string]string{"X-Api-Version": "1"}},
+			match:    &MatchConditions{Headers: map[string]string{"x-api-version": "2"}},
+		},
+		{
+			name:     "different specificity",
+			existing: &MatchConditions{QueryParameters: map[string]string{"action": "read"}},
+			match:    &MatchConditions{QueryParameters: map[string]string{"action": "read"}, Headers: map[string]string{"X-Api-Version": "2"}},
+		},
+		{
+			name:     "same conditions",
+			existing: &MatchConditions{QueryParameters: map[string]string{"action": "read"}},
+			match:    &MatchConditions{QueryParameters: map[string]string{"action": "read"}},
+			wantErr:  true,
+		},
+		{
+			name:     "conditions on different parameters can be met together",
+			existing: &MatchConditions{QueryParameters: map[string]string{"action": "read"}},
+			match:    &MatchConditions{Headers: map[string]string{"X-Api-Version": "2"}},
+			wantErr:  true,
+		},
+		{
+			name:    "no conditions on both rules",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gri := NewGenerationRulesImp(nil, false)
+
+			if err := gri.UpsertTraTRule(newTestRuleWithMatch("existing", tt.existing)); err != nil {
+				t.Fatalf("UpsertTraTRule(existing) error = %v", err)
+			}
+
+			err := gri.UpsertTraTRule(newTestRuleWithMatch("new", tt.match))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpsertTraTRule(new) error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil && !errors.Is(err, ErrInvalidTraTRule) {
+				t.Errorf("UpsertTraTRule(new) error = %v, want %v", err, ErrInvalidTraTRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/logging"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"go.uber.org/zap"
+)
+
+// MatchedRequest is a txn token request with the trat generation rule it matched and the configuration the rule
+// is applied with, taken together under the read lock. A token is issued from a single, consistent view of the
+// rules even while they are updated, and the methods of MatchedRequest take no lock.
+type MatchedRequest struct {
+	txnTokenRequest *common.TokenRequest
+	// rule is nil when no rule matches the request and the no matching rule fallback applies.
+	rule             *TraTGenerationRule
+	pathParameter    map[string]interface{}
+	fallbackPurp     string
+	tokenSettings    TokenSettings
+	claimsProjection *ClaimsProjection
+	accessEvaluator  *accessevaluation.AccessEvaluator
+}
+
+// MatchRequest matches the request against the trat generation rules. A request matching no rule is rejected with
+// ErrNoMatchingRule, unless the no matching rule fallback issues it a token.
+func (gri *GenerationRulesImp) MatchRequest(txnTokenRequest *common.TokenRequest) (*MatchedRequest, error) {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	path := txnTokenRequest.RequestDetails.Path
+	method := txnTokenRequest.RequestDetails.Method
+
+	matchedRequest := &MatchedRequest{
+		txnTokenRequest: txnTokenRequest,
+		accessEvaluator: gri.accessevaluator,
+	}
+
+	ruleMatchStart := time.Now()
+
+	generationTraTRule, pathParameter, err := gri.matchRule(txnTokenRequest.RequestDetails)
+
+	metrics.ObserveStage(metrics.STAGE_RULE_MATCH, ruleMatchStart)
+
+	if errors.Is(err, tokeneteserrors.ErrNoMatchingRule) {
+		if purp, ok := gri.noMatchingRuleFallback(); ok {
+			logging.GetLogger("generation-rules").Info("No trat generation rule matches the request; issuing a token with the fallback purp.",
+				zap.String("path", path),
+				zap.String("method", string(method)),
+				zap.String("purp", purp))
+
+			matchedRequest.fallbackPurp = purp
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error matching generation rule for %s path and %s method: %w", path, string(method), err)
+	}
+
+	matchedRequest.rule = generationTraTRule
+	matchedRequest.pathParameter = pathParameter
+
+	var token *TokenetesConfigToken
+	var namespaceProjection, ruleProjection *ClaimsProjection
+
+	if gri.generationRules.TokenetesConfigGenerationRule != nil {
+		token = gri.generationRules.TokenetesConfigGenerationRule.Token
+		namespaceProjection = gri.generationRules.TokenetesConfigGenerationRule.ClaimsProjection
+	}
+
+	if generationTraTRule != nil {
+		ruleProjection = generationTraTRule.ClaimsProjection
+	}
+
+	matchedRequest.tokenSettings, err = resolveTokenSettings(token, generationTraTRule)
+	if err != nil {
+		return nil, err
+	}
+
+	matchedRequest.claimsProjection = mergeClaimsProjections(namespaceProjection, ruleProjection)
+
+	return matchedRequest, nil
+}
+
+// TraTName returns the name of the trat of the matching rule, or an empty string for a fallback token.
+func (mr *MatchedRequest) TraTName() string {
+	if mr.rule == nil {
+		return ""
+	}
+
+	return mr.rule.TraTName
+}
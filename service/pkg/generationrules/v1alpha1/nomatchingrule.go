@@ -0,0 +1,54 @@
+package v1alpha1
+
+const (
+	// NO_MATCHING_RULE_DENY rejects the request with an invalid_request error. It is the default.
+	NO_MATCHING_RULE_DENY = "deny"
+	// NO_MATCHING_RULE_GENERIC issues a token with the configured generic purp and no azd.
+	NO_MATCHING_RULE_GENERIC = "generic"
+	// NO_MATCHING_RULE_LEARN behaves as NO_MATCHING_RULE_GENERIC on instances started in learning mode, logging the
+	// unmatched requests, and as NO_MATCHING_RULE_DENY on the others.
+	NO_MATCHING_RULE_LEARN = "learn"
+)
+
+const DEFAULT_LEARNING_MODE_PURP = "learning"
+
+// NoMatchingRule configures how requests that match no trat generation rule are handled. It lets teams onboard
+// large APIs incrementally. Fallback tokens are issued without access evaluation, since the access evaluation
+// request mapping and the local policy are part of the rule; DenyWhenAccessEvaluationEnabled denies the requests
+// instead while access evaluation is enabled.
+type NoMatchingRule struct {
+	Action                          string `json:"action"`
+	Purp                            string `json:"purp,omitempty"`
+	DenyWhenAccessEvaluationEnabled bool   `json:"denyWhenAccessEvaluationEnabled,omitempty"`
+}
+
+// Read lock should be taken by the function calling noMatchingRuleFallback. It returns the purp to issue a token
+// with, if the request may be issued one without a matching rule.
+func (gri *GenerationRulesImp) noMatchingRuleFallback() (string, bool) {
+	if gri.generationRules.TokenetesConfigGenerationRule == nil || gri.generationRules.TokenetesConfigGenerationRule.NoMatchingRule == nil {
+		return "", false
+	}
+
+	noMatchingRule := gri.generationRules.TokenetesConfigGenerationRule.NoMatchingRule
+
+	if noMatchingRule.DenyWhenAccessEvaluationEnabled && gri.accessevaluator != nil && gri.accessevaluator.IsAccessEvaluationEnabled() {
+		return "", false
+	}
+
+	switch noMatchingRule.Action {
+	case NO_MATCHING_RULE_GENERIC:
+		return noMatchingRule.Purp, noMatchingRule.Purp != ""
+	case NO_MATCHING_RULE_LEARN:
+		if !gri.learningMode {
+			return "", false
+		}
+
+		if noMatchingRule.Purp == "" {
+			return DEFAULT_LEARNING_MODE_PURP, true
+		}
+
+		return noMatchingRule.Purp, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,143 @@
+package v1alpha1
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"go.uber.org/zap"
+)
+
+func TestNoMatchingRuleFallback(t *testing.T) {
+	tests := []struct {
+		name           string
+		noMatchingRule *NoMatchingRule
+		learningMode   bool
+		// withAccessEvaluationAPI configures an access evaluation api, enabled as accessEvaluationEnabled.
+		withAccessEvaluationAPI bool
+		accessEvaluationEnabled bool
+		wantPurp                string
+		wantFallback            bool
+	}{
+		{
+			name: "no fallback configured",
+		},
+		{
+			name:           "deny",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_DENY, Purp: "generic"},
+		},
+		{
+			name:           "unknown action denies",
+			noMatchingRule: &NoMatchingRule{Action: "allow", Purp: "generic"},
+		},
+		{
+			name:           "generic",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC, Purp: "generic"},
+			wantPurp:       "generic",
+			wantFallback:   true,
+		},
+		{
+			name:           "generic without a purp denies",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC},
+		},
+		{
+			name:           "learn in learning mode",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_LEARN, Purp: "onboarding"},
+			learningMode:   true,
+			wantPurp:       "onboarding",
+			wantFallback:   true,
+		},
+		{
+			name:           "learn in learning mode with the default purp",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_LEARN},
+			learningMode:   true,
+			wantPurp:       DEFAULT_LEARNING_MODE_PURP,
+			wantFallback:   true,
+		},
+		{
+			name:           "learn without learning mode denies",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_LEARN, Purp: "onboarding"},
+		},
+		{
+			name:                    "generic while access evaluation is enabled",
+			noMatchingRule:          &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC, Purp: "generic"},
+			withAccessEvaluationAPI: true,
+			accessEvaluationEnabled: true,
+			wantPurp:                "generic",
+			wantFallback:            true,
+		},
+		{
+			name:                    "denyWhenAccessEvaluationEnabled denies while access evaluation is enabled",
+			noMatchingRule:          &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC, Purp: "generic", DenyWhenAccessEvaluationEnabled: true},
+			withAccessEvaluationAPI: true,
+			accessEvaluationEnabled: true,
+		},
+		{
+			name:                    "denyWhenAccessEvaluationEnabled denies learning while access evaluation is enabled",
+			noMatchingRule:          &NoMatchingRule{Action: NO_MATCHING_RULE_LEARN, DenyWhenAccessEvaluationEnabled: true},
+			learningMode:            true,
+			withAccessEvaluationAPI: true,
+			accessEvaluationEnabled: true,
+		},
+		{
+			name:                    "denyWhenAccessEvaluationEnabled while access evaluation is disabled",
+			noMatchingRule:          &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC, Purp: "generic", DenyWhenAccessEvaluationEnabled: true},
+			withAccessEvaluationAPI: true,
+			wantPurp:                "generic",
+			wantFallback:            true,
+		},
+		{
+			name:           "denyWhenAccessEvaluationEnabled without an access evaluation api",
+			noMatchingRule: &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC, Purp: "generic", DenyWhenAccessEvaluationEnabled: true},
+			wantPurp:       "generic",
+			wantFallback:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gri := NewGenerationRulesImp(nil, tt.learningMode)
+
+			tokenetesConfigRule := newTestTokenetesConfigRule()
+			tokenetesConfigRule.NoMatchingRule = tt.noMatchingRule
+			gri.generationRules.TokenetesConfigGenerationRule = tokenetesConfigRule
+
+			if tt.withAccessEvaluationAPI {
+				gri.accessevaluator = accessevaluation.NewAccessEvaluator(accessevaluation.AccessEvaluationAPI{
+					Endpoint:               "https://pdp.example",
+					EnableAccessEvaluation: tt.accessEvaluationEnabled,
+				}, nil, zap.NewNop())
+			}
+
+			if err := gri.UpsertTraTRule(*newTestRule("list-accounts", common.Get, "/accounts")); err != nil {
+				t.Fatalf("UpsertTraTRule() error = %v", err)
+			}
+
+			matchedRequest, err := gri.MatchRequest(&common.TokenRequest{RequestDetails: common.RequestDetails{Path: "/transfers", Method: common.Post}})
+
+			if !tt.wantFallback {
+				if !errors.Is(err, tokeneteserrors.ErrNoMatchingRule) {
+					t.Errorf("MatchRequest() error = %v, want %v", err, tokeneteserrors.ErrNoMatchingRule)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("MatchRequest() error = %v", err)
+			}
+
+			if matchedRequest.fallbackPurp != tt.wantPurp || matchedRequest.TraTName() != "" {
+				t.Errorf("MatchRequest() fallback purp = %q, trat = %q, want %q and no trat", matchedRequest.fallbackPurp, matchedRequest.TraTName(), tt.wantPurp)
+			}
+
+			// Requests matching a rule are unaffected by the fallback.
+			matchedRequest, err = gri.MatchRequest(&common.TokenRequest{RequestDetails: common.RequestDetails{Path: "/accounts", Method: common.Get}})
+			if err != nil || matchedRequest.TraTName() != "list-accounts" || matchedRequest.fallbackPurp != "" {
+				t.Errorf("MatchRequest() for a matching request = %+v, %v, want the list-accounts rule", matchedRequest, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package v1alpha1
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+)
+
+const (
+	PURP_REFERENCE_PREFIX = "${"
+	PURP_REFERENCE_SUFFIX = "}"
+)
+
+// isTemplatedPurp reports whether the purp has ${...} references to the request, e.g. "orders.${body.operation}".
+func isTemplatedPurp(purp string) bool {
+	return strings.Contains(purp, PURP_REFERENCE_PREFIX)
+}
+
+// expandPurp replaces every ${...} reference of the purp with the value returned by resolve for its path.
+func expandPurp(purp string, resolve func(string) (string, error)) (string, error) {
+	var expanded strings.Builder
+
+	rest := purp
+
+	for {
+		start := strings.Index(rest, PURP_REFERENCE_PREFIX)
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(rest[start:], PURP_REFERENCE_SUFFIX)
+		if end < 0 {
+			return "", fmt.Errorf("unclosed reference in purp %s", purp)
+		}
+
+		end += start
+
+		referencePath := rest[start+len(PURP_REFERENCE_PREFIX) : end]
+		if referencePath == "" {
+			return "", fmt.Errorf("empty reference in purp %s", purp)
+		}
+
+		value, err := resolve(referencePath)
+		if err != nil {
+			return "", err
+		}
+
+		expanded.WriteString(rest[:start] + value)
+
+		rest = rest[end+len(PURP_REFERENCE_SUFFIX):]
+	}
+
+	expanded.WriteString(rest)
+
+	return expanded.String(), nil
+}
+
+// resolvePurp resolves a templated purp against the azd input document and checks the result against the
+// allowlist, whose entries are path.Match patterns such as "orders.*".
+func resolvePurp(rule *TraTGenerationRule, input map[string]interface{}) (string, error) {
+	if !isTemplatedPurp(rule.Purp) {
+		return rule.Purp, nil
+	}
+
+	jsonInput, err := marshalToJson(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal input to JSON: %w", err)
+	}
+
+	purp, err := expandPurp(rule.Purp, func(referencePath string) (string, error) {
+		value := extractValueFromJson(jsonInput, referencePath)
+		if value == nil {
+			return "", fmt.Errorf("%w: failed to extract purp value from path %s", tokeneteserrors.ErrInvalidRequestDetails, referencePath)
+		}
+
+		return stringify(value), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for _, pattern := range rule.PurpAllowlist {
+		if matched, _ := path.Match(pattern, purp); matched {
+			return purp, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: purp %s is not in the purp allowlist", tokeneteserrors.ErrAccessDenied, purp)
+}
@@ -0,0 +1,147 @@
+package v1alpha1
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+)
+
+func TestResolvePurp(t *testing.T) {
+	input := map[string]interface{}{
+		"request": map[string]interface{}{
+			"body": map[string]interface{}{
+				"operation": "create",
+				"version":   2.0,
+			},
+			"pathParameters": map[string]interface{}{
+				"resource": "orders",
+				"path":     "create/../admin",
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		purp          string
+		purpAllowlist []string
+		want          string
+		wantErr       error
+	}{
+		{
+			name: "static purp",
+			purp: "orders.read",
+			want: "orders.read",
+		},
+		{
+			name:          "single reference",
+			purp:          "orders.${request.body.operation}",
+			purpAllowlist: []string{"orders.*"},
+			want:          "orders.create",
+		},
+		{
+			name:          "several references",
+			purp:          "${request.pathParameters.resource}.${request.body.operation}.v${request.body.version}",
+			purpAllowlist: []string{"orders.create.v*"},
+			want:          "orders.create.v2",
+		},
+		{
+			name:          "exact allowlist entry",
+			purp:          "orders.${request.body.operation}",
+			purpAllowlist: []string{"orders.read", "orders.create"},
+			want:          "orders.create",
+		},
+		{
+			name:          "purp outside the allowlist",
+			purp:          "orders.${request.body.operation}",
+			purpAllowlist: []string{"orders.read", "payments.*"},
+			wantErr:       tokeneteserrors.ErrAccessDenied,
+		},
+		{
+			name:          "wildcards do not match slashes",
+			purp:          "orders.${request.pathParameters.path}",
+			purpAllowlist: []string{"orders.*"},
+			wantErr:       tokeneteserrors.ErrAccessDenied,
+		},
+		{
+			name:          "missing reference",
+			purp:          "orders.${request.body.missing}",
+			purpAllowlist: []string{"orders.*"},
+			wantErr:       tokeneteserrors.ErrInvalidRequestDetails,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &TraTGenerationRule{Purp: tt.purp, PurpAllowlist: tt.purpAllowlist}
+
+			purp, err := resolvePurp(rule, input)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("resolvePurp() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolvePurp() error = %v", err)
+			}
+
+			if purp != tt.want {
+				t.Errorf("resolvePurp() = %s, want %s", purp, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePurp(t *testing.T) {
+	tests := []struct {
+		name          string
+		purp          string
+		purpAllowlist []string
+		wantErr       bool
+	}{
+		{
+			name: "static purp without an allowlist",
+			purp: "orders.read",
+		},
+		{
+			name:          "templated purp with an allowlist",
+			purp:          "orders.${request.body.operation}",
+			purpAllowlist: []string{"orders.*"},
+		},
+		{
+			name:    "templated purp without an allowlist",
+			purp:    "orders.${request.body.operation}",
+			wantErr: true,
+		},
+		{
+			name:          "unclosed reference",
+			purp:          "orders.${request.body.operation",
+			purpAllowlist: []string{"orders.*"},
+			wantErr:       true,
+		},
+		{
+			name:          "empty reference",
+			purp:          "orders.${}",
+			purpAllowlist: []string{"orders.*"},
+			wantErr:       true,
+		},
+		{
+			name:          "malformed allowlist pattern",
+			purp:          "orders.read",
+			purpAllowlist: []string{"orders.["},
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePurp(tt.purp, tt.purpAllowlist); (err != nil) != tt.wantErr {
+				t.Errorf("validatePurp() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
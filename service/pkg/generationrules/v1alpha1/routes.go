@@ -0,0 +1,677 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+const (
+	PATH_PARAMETER_PREFIX   = "{#"
+	PATH_PARAMETER_SUFFIX   = "}"
+	PATH_PARAMETER_WILDCARD = "*"
+)
+
+// Path parameter types, used as {#name:type}. A parameter without a type is a string.
+const (
+	PATH_PARAMETER_TYPE_STRING = "string"
+	PATH_PARAMETER_TYPE_INT    = "int"
+	PATH_PARAMETER_TYPE_NUMBER = "number"
+	PATH_PARAMETER_TYPE_BOOL   = "bool"
+	PATH_PARAMETER_TYPE_UUID   = "uuid"
+	// PATH_PARAMETER_TYPE_REGEX is used as {#name:regex(<pattern>)}; braces in the pattern must be balanced.
+	PATH_PARAMETER_TYPE_REGEX = "regex"
+)
+
+var pathParameterTypePatterns = map[string]string{
+	PATH_PARAMETER_TYPE_STRING: `[^/]+`,
+	PATH_PARAMETER_TYPE_INT:    `-?[0-9]+`,
+	PATH_PARAMETER_TYPE_NUMBER: `-?[0-9]+(?:\.[0-9]+)?`,
+	PATH_PARAMETER_TYPE_BOOL:   `true|false`,
+	PATH_PARAMETER_TYPE_UUID:   `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// pathParameterTypeRanks orders the constrained parameters of a segment, narrower types first. uuid, int and bool
+// values never overlap, and an int is also a number.
+var pathParameterTypeRanks = map[string]int{
+	PATH_PARAMETER_TYPE_UUID:   0,
+	PATH_PARAMETER_TYPE_INT:    1,
+	PATH_PARAMETER_TYPE_BOOL:   2,
+	PATH_PARAMETER_TYPE_NUMBER: 3,
+	PATH_PARAMETER_TYPE_REGEX:  4,
+}
+
+type segmentKind int
+
+const (
+	staticSegment segmentKind = iota
+	// patternSegment mixes literal text and parameters, e.g. "{#id}.json".
+	patternSegment
+	// constrainedSegment is a single typed parameter, e.g. "{#id:int}".
+	constrainedSegment
+	parameterSegment
+	// wildcardSegment is a trailing "{#rest*}" that matches all the remaining segments.
+	wildcardSegment
+)
+
+type pathParameter struct {
+	name      string
+	paramType string
+	pattern   string
+	wildcard  bool
+}
+
+// routeSegment is a compiled path template segment. Parameter names are not part of it, so that templates which
+// only differ in their parameter names share the same route.
+type routeSegment struct {
+	kind segmentKind
+	// key is the segment with the parameter names removed, e.g. "{:int}.json".
+	key            string
+	prefix         string
+	suffix         string
+	literalLength  int
+	parameterTypes []string
+	regex          *regexp.Regexp
+}
+
+type routeLeaf struct {
+	rule           *TraTGenerationRule
+	parameterNames []string
+}
+
+type dynamicRoute struct {
+	segment routeSegment
+	node    *routeNode
+}
+
+type routeNode struct {
+	static  map[string]*routeNode
+	dynamic []*dynamicRoute
+	// leaves are the rules of the node's path template, most specific match conditions first.
+	leaves []*routeLeaf
+}
+
+// routeTree matches request paths against the path templates of the trat generation rules of one http method.
+// At every segment a static segment beats a pattern segment, then a typed parameter, then a plain parameter and
+// finally a wildcard, so a longer template beats a shorter one ending in a wildcard. Among pattern segments the
+// one with more literal text wins. Ties are rejected when the rules are indexed, so the matched rule never
+// depends on the order in which the rules were added.
+type routeTree struct {
+	root *routeNode
+}
+
+func newRouteNode() *routeNode {
+	return &routeNode{static: make(map[string]*routeNode)}
+}
+
+func newRouteTree() *routeTree {
+	return &routeTree{root: newRouteNode()}
+}
+
+func newIndexedTraTsGenerationRules() IndexedTraTsGenerationRules {
+	indexedTraTsGenerationRules := make(IndexedTraTsGenerationRules)
+
+	for _, method := range common.HttpMethodList {
+		indexedTraTsGenerationRules[method] = newRouteTree()
+	}
+
+	return indexedTraTsGenerationRules
+}
+
+// buildIndexedTraTsGenerationRules indexes the rules in TraTName order and returns the index with the rules it
+// holds. A rule that is invalid or conflicts with an already indexed rule is left out and reported in the returned
+// ValidationErrors.
+func buildIndexedTraTsGenerationRules(traTsGenerationRules map[string]*TraTGenerationRule) (IndexedTraTsGenerationRules, map[string]*TraTGenerationRule, error) {
+	indexedTraTsGenerationRules := newIndexedTraTsGenerationRules()
+	var indexedRules map[string]*TraTGenerationRule
+	if traTsGenerationRules != nil {
+		indexedRules = make(map[string]*TraTGenerationRule, len(traTsGenerationRules))
+	}
+
+	traTNames := make([]string, 0, len(traTsGenerationRules))
+	for traTName := range traTsGenerationRules {
+		traTNames = append(traTNames, traTName)
+	}
+
+	sort.Strings(traTNames)
+
+	var validationErrors ValidationErrors
+
+	for _, traTName := range traTNames {
+		if err := indexedTraTsGenerationRules.insert(traTsGenerationRules[traTName]); err != nil {
+			validationErrors = append(validationErrors, err)
+
+			continue
+		}
+
+		indexedRules[traTName] = traTsGenerationRules[traTName]
+	}
+
+	if len(validationErrors) > 0 {
+		return indexedTraTsGenerationRules, indexedRules, validationErrors
+	}
+
+	return indexedTraTsGenerationRules, indexedRules, nil
+}
+
+func (i IndexedTraTsGenerationRules) insert(rule *TraTGenerationRule) *ValidationError {
+	if err := rule.Validate(); err != nil {
+		var validationError *ValidationError
+		if errors.As(err, &validationError) {
+			return validationError
+		}
+
+		return newTraTRuleError(rule.TraTName, "", err)
+	}
+
+	if err := i[rule.Method].insert(rule); err != nil {
+		return newTraTRuleError(rule.TraTName, "path", err)
+	}
+
+	return nil
+}
+
+func (t *routeTree) insert(rule *TraTGenerationRule) error {
+	segments, parameterNames, err := compilePathTemplate(rule.Path)
+	if err != nil {
+		return fmt.Errorf("invalid path template %q: %w", rule.Path, err)
+	}
+
+	node := t.root
+
+	for _, segment := range segments {
+		node, err = node.child(segment)
+		if err != nil {
+			return fmt.Errorf("path %s is ambiguous: %w", rule.Path, err)
+		}
+	}
+
+	return node.addLeaf(&routeLeaf{rule: rule, parameterNames: parameterNames})
+}
+
+// addLeaf rejects a rule that can match the same requests as another rule of the node with equally specific match
+// conditions.
+func (n *routeNode) addLeaf(leaf *routeLeaf) error {
+	for _, other := range n.leaves {
+		if other.rule.Match.specificity() == leaf.rule.Match.specificity() && !other.rule.Match.isDisjointWith(leaf.rule.Match) {
+			return fmt.Errorf("path %s %s with match conditions %s matches the same requests as %s of %s with match conditions %s",
+				string(leaf.rule.Method), leaf.rule.Path, leaf.rule.Match, other.rule.Path, other.rule.TraTName, other.rule.Match)
+		}
+	}
+
+	n.leaves = append(n.leaves, leaf)
+
+	sort.SliceStable(n.leaves, func(i, j int) bool {
+		return n.leaves[i].rule.Match.specificity() > n.leaves[j].rule.Match.specificity()
+	})
+
+	return nil
+}
+
+func (n *routeNode) matchLeaf(request *requestAttributes) *routeLeaf {
+	for _, leaf := range n.leaves {
+		if leaf.rule.Match.matches(request) {
+			return leaf
+		}
+	}
+
+	return nil
+}
+
+// child returns the node for the segment, creating it if needed. A new segment is rejected if a request segment
+// could match both it and another segment of the same precedence.
+func (n *routeNode) child(segment routeSegment) (*routeNode, error) {
+	if segment.kind == staticSegment {
+		child, ok := n.static[segment.key]
+		if !ok {
+			child = newRouteNode()
+			n.static[segment.key] = child
+		}
+
+		return child, nil
+	}
+
+	for _, route := range n.dynamic {
+		if route.segment.key == segment.key {
+			return route.node, nil
+		}
+
+		if route.segment.isAmbiguousWith(segment) {
+			return nil, fmt.Errorf("segments %s and %s can match the same value", route.segment.key, segment.key)
+		}
+	}
+
+	route := &dynamicRoute{segment: segment, node: newRouteNode()}
+	n.dynamic = append(n.dynamic, route)
+
+	sort.SliceStable(n.dynamic, func(i, j int) bool {
+		return n.dynamic[i].segment.precedes(n.dynamic[j].segment)
+	})
+
+	return route.node, nil
+}
+
+func (s routeSegment) precedes(other routeSegment) bool {
+	if s.kind != other.kind {
+		return s.kind < other.kind
+	}
+
+	switch s.kind {
+	case patternSegment:
+		if s.literalLength != other.literalLength {
+			return s.literalLength > other.literalLength
+		}
+	case constrainedSegment:
+		if s.typeRank() != other.typeRank() {
+			return s.typeRank() < other.typeRank()
+		}
+	}
+
+	return s.key < other.key
+}
+
+func (s routeSegment) typeRank() int {
+	return pathParameterTypeRanks[s.parameterTypes[0]]
+}
+
+// isAmbiguousWith reports whether a value may match two different segments of the same precedence. Two regex
+// constraints always are, since their overlap cannot be decided. Pattern segments are only known to be disjoint
+// when their leading or trailing literal text differs.
+func (s routeSegment) isAmbiguousWith(other routeSegment) bool {
+	if s.kind != other.kind || s.key == other.key {
+		return false
+	}
+
+	switch s.kind {
+	case constrainedSegment:
+		return s.typeRank() == other.typeRank()
+	case patternSegment:
+		if s.literalLength != other.literalLength {
+			return false
+		}
+	default:
+		return false
+	}
+
+	if !strings.HasPrefix(s.prefix, other.prefix) && !strings.HasPrefix(other.prefix, s.prefix) {
+		return false
+	}
+
+	if !strings.HasSuffix(s.suffix, other.suffix) && !strings.HasSuffix(other.suffix, s.suffix) {
+		return false
+	}
+
+	return true
+}
+
+// compilePathTemplate returns the compiled segments of the template and the names of its parameters in order.
+func compilePathTemplate(template string) ([]routeSegment, []string, error) {
+	if !strings.HasPrefix(template, "/") {
+		return nil, nil, errors.New("path must start with /")
+	}
+
+	templateSegments, err := splitPathTemplate(template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	segments := make([]routeSegment, 0, len(templateSegments))
+	parameterNames := make([]string, 0)
+	seenParameterNames := make(map[string]bool)
+
+	for i, templateSegment := range templateSegments {
+		segment, names, err := compileSegment(templateSegment)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if segment.kind == wildcardSegment && i != len(templateSegments)-1 {
+			return nil, nil, errors.New("wildcard parameter must be the last segment")
+		}
+
+		for _, name := range names {
+			if seenParameterNames[name] {
+				return nil, nil, fmt.Errorf("duplicate path parameter %s", name)
+			}
+
+			seenParameterNames[name] = true
+		}
+
+		segments = append(segments, segment)
+		parameterNames = append(parameterNames, names...)
+	}
+
+	return segments, parameterNames, nil
+}
+
+// splitPathTemplate splits the template on the slashes that are not inside a path parameter.
+func splitPathTemplate(template string) ([]string, error) {
+	segments := make([]string, 0)
+	depth, start := 0, 0
+
+	for i := 0; i < len(template); i++ {
+		switch template[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unexpected %s at position %d", PATH_PARAMETER_SUFFIX, i)
+			}
+
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, template[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if depth != 0 {
+		return nil, errors.New("unclosed path parameter")
+	}
+
+	return append(segments, template[start:]), nil
+}
+
+func compileSegment(templateSegment string) (routeSegment, []string, error) {
+	var (
+		literals   []string
+		parameters []pathParameter
+	)
+
+	rest := templateSegment
+
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			break
+		}
+
+		if !strings.HasPrefix(rest[start:], PATH_PARAMETER_PREFIX) {
+			return routeSegment{}, nil, fmt.Errorf("path parameter in segment %s must start with %s", templateSegment, PATH_PARAMETER_PREFIX)
+		}
+
+		end := closingBrace(rest, start)
+
+		literal := rest[:start]
+		if len(parameters) > 0 && literal == "" {
+			return routeSegment{}, nil, fmt.Errorf("adjacent path parameters in segment %s", templateSegment)
+		}
+
+		parameter, err := parsePathParameter(rest[start+len(PATH_PARAMETER_PREFIX) : end])
+		if err != nil {
+			return routeSegment{}, nil, fmt.Errorf("segment %s: %w", templateSegment, err)
+		}
+
+		literals = append(literals, literal)
+		parameters = append(parameters, parameter)
+
+		rest = rest[end+len(PATH_PARAMETER_SUFFIX):]
+	}
+
+	if len(parameters) == 0 {
+		return routeSegment{kind: staticSegment, key: templateSegment, literalLength: len(templateSegment)}, nil, nil
+	}
+
+	literals = append(literals, rest)
+
+	names := make([]string, 0, len(parameters))
+	parameterTypes := make([]string, 0, len(parameters))
+
+	for _, parameter := range parameters {
+		names = append(names, parameter.name)
+		parameterTypes = append(parameterTypes, parameter.paramType)
+	}
+
+	if len(parameters) == 1 && literals[0] == "" && literals[1] == "" {
+		parameter := parameters[0]
+
+		switch {
+		case parameter.wildcard:
+			return routeSegment{kind: wildcardSegment, key: "{*}", parameterTypes: parameterTypes}, names, nil
+		case parameter.paramType == PATH_PARAMETER_TYPE_STRING:
+			return routeSegment{kind: parameterSegment, key: "{}", parameterTypes: parameterTypes}, names, nil
+		default:
+			return routeSegment{
+				kind:           constrainedSegment,
+				key:            parameterKey(parameter),
+				parameterTypes: parameterTypes,
+				regex:          regexp.MustCompile("^(?:" + parameter.pattern + ")$"),
+			}, names, nil
+		}
+	}
+
+	var key, regex strings.Builder
+
+	regex.WriteString("^")
+
+	literalLength := 0
+
+	for i, parameter := range parameters {
+		if parameter.wildcard {
+			return routeSegment{}, nil, fmt.Errorf("wildcard parameter %s must be a whole segment", parameter.name)
+		}
+
+		key.WriteString(literals[i] + parameterKey(parameter))
+		regex.WriteString(regexp.QuoteMeta(literals[i]) + fmt.Sprintf("(?P<p%d>%s)", i, parameter.pattern))
+
+		literalLength += len(literals[i])
+	}
+
+	key.WriteString(rest)
+	regex.WriteString(regexp.QuoteMeta(rest) + "$")
+
+	literalLength += len(rest)
+
+	return routeSegment{
+		kind:           patternSegment,
+		key:            key.String(),
+		prefix:         literals[0],
+		suffix:         rest,
+		literalLength:  literalLength,
+		parameterTypes: parameterTypes,
+		regex:          regexp.MustCompile(regex.String()),
+	}, names, nil
+}
+
+// closingBrace returns the index of the brace closing the one at start; splitPathTemplate has already checked that
+// the braces are balanced.
+func closingBrace(s string, start int) int {
+	depth := 0
+
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return len(s)
+}
+
+// parsePathParameter parses the inside of a path parameter: name, name:type, name:regex(<pattern>) or name*.
+func parsePathParameter(spec string) (pathParameter, error) {
+	if name, ok := strings.CutSuffix(spec, PATH_PARAMETER_WILDCARD); ok && !strings.Contains(name, ":") {
+		if name == "" {
+			return pathParameter{}, errors.New("empty path parameter name")
+		}
+
+		return pathParameter{name: name, paramType: PATH_PARAMETER_TYPE_STRING, pattern: ".+", wildcard: true}, nil
+	}
+
+	name, paramType, hasType := strings.Cut(spec, ":")
+	if name == "" {
+		return pathParameter{}, errors.New("empty path parameter name")
+	}
+
+	if !hasType {
+		paramType = PATH_PARAMETER_TYPE_STRING
+	}
+
+	if pattern, ok := pathParameterTypePatterns[paramType]; ok {
+		return pathParameter{name: name, paramType: paramType, pattern: pattern}, nil
+	}
+
+	if !strings.HasPrefix(paramType, PATH_PARAMETER_TYPE_REGEX+"(") || !strings.HasSuffix(paramType, ")") {
+		return pathParameter{}, fmt.Errorf("unsupported type %s for path parameter %s", paramType, name)
+	}
+
+	pattern := strings.TrimSuffix(strings.TrimPrefix(paramType, PATH_PARAMETER_TYPE_REGEX+"("), ")")
+	if pattern == "" {
+		return pathParameter{}, fmt.Errorf("empty regex for path parameter %s", name)
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return pathParameter{}, fmt.Errorf("invalid regex for path parameter %s: %w", name, err)
+	}
+
+	return pathParameter{name: name, paramType: PATH_PARAMETER_TYPE_REGEX, pattern: pattern}, nil
+}
+
+func parameterKey(parameter pathParameter) string {
+	switch parameter.paramType {
+	case PATH_PARAMETER_TYPE_STRING:
+		return "{}"
+	case PATH_PARAMETER_TYPE_REGEX:
+		return "{:regex(" + parameter.pattern + ")}"
+	default:
+		return "{:" + parameter.paramType + "}"
+	}
+}
+
+// convertPathParameter converts a matched value to its type, so that it reaches the azd and the access evaluation
+// request as a JSON number or boolean.
+func convertPathParameter(paramType string, value string) (interface{}, bool) {
+	switch paramType {
+	case PATH_PARAMETER_TYPE_INT:
+		number, err := strconv.ParseInt(value, 10, 64)
+
+		return number, err == nil
+	case PATH_PARAMETER_TYPE_NUMBER:
+		number, err := strconv.ParseFloat(value, 64)
+
+		return number, err == nil
+	case PATH_PARAMETER_TYPE_BOOL:
+		return value == "true", true
+	default:
+		return value, true
+	}
+}
+
+// match returns the typed parameter values captured from the request path segment.
+func (s routeSegment) match(value string) ([]interface{}, bool) {
+	var rawValues []string
+
+	switch s.kind {
+	case staticSegment:
+		return nil, value == s.key
+	case parameterSegment:
+		if value == "" {
+			return nil, false
+		}
+
+		return []interface{}{value}, true
+	case constrainedSegment:
+		if !s.regex.MatchString(value) {
+			return nil, false
+		}
+
+		rawValues = []string{value}
+	case patternSegment:
+		matches := s.regex.FindStringSubmatch(value)
+		if matches == nil {
+			return nil, false
+		}
+
+		rawValues = make([]string, len(s.parameterTypes))
+		for i := range s.parameterTypes {
+			rawValues[i] = matches[s.regex.SubexpIndex(fmt.Sprintf("p%d", i))]
+		}
+	default:
+		return nil, false
+	}
+
+	values := make([]interface{}, 0, len(rawValues))
+
+	for i, rawValue := range rawValues {
+		typedValue, ok := convertPathParameter(s.parameterTypes[i], rawValue)
+		if !ok {
+			return nil, false
+		}
+
+		values = append(values, typedValue)
+	}
+
+	return values, true
+}
+
+func (t *routeTree) lookup(path string, request *requestAttributes) (*TraTGenerationRule, map[string]interface{}, bool) {
+	leaf, values := t.root.lookup(strings.Split(path, "/"), request, nil)
+	if leaf == nil {
+		return nil, nil, false
+	}
+
+	pathParameters := make(map[string]interface{}, len(leaf.parameterNames))
+
+	for i, name := range leaf.parameterNames {
+		pathParameters[name] = values[i]
+	}
+
+	return leaf.rule, pathParameters, true
+}
+
+// lookup walks the routes in precedence order and only backtracks when a more specific route has no rule for
+// the remaining segments.
+func (n *routeNode) lookup(segments []string, request *requestAttributes, values []interface{}) (*routeLeaf, []interface{}) {
+	if len(segments) == 0 {
+		leaf := n.matchLeaf(request)
+		if leaf == nil {
+			return nil, nil
+		}
+
+		return leaf, values
+	}
+
+	if child, ok := n.static[segments[0]]; ok {
+		if leaf, leafValues := child.lookup(segments[1:], request, values); leaf != nil {
+			return leaf, leafValues
+		}
+	}
+
+	for _, route := range n.dynamic {
+		if route.segment.kind == wildcardSegment {
+			rest := strings.Join(segments, "/")
+			if rest == "" {
+				continue
+			}
+
+			if leaf := route.node.matchLeaf(request); leaf != nil {
+				return leaf, append(values[:len(values):len(values)], rest)
+			}
+
+			continue
+		}
+
+		segmentValues, ok := route.segment.match(segments[0])
+		if !ok {
+			continue
+		}
+
+		if leaf, leafValues := route.node.lookup(segments[1:], request, append(values[:len(values):len(values)], segmentValues...)); leaf != nil {
+			return leaf, leafValues
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,356 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+func newTestRule(traTName string, method common.HttpMethod, path string) *TraTGenerationRule {
+	return &TraTGenerationRule{TraTName: traTName, Path: path, Method: method, Purp: traTName}
+}
+
+func TestRouteTreeLookup(t *testing.T) {
+	rules := []*TraTGenerationRule{
+		newTestRule("list-accounts", common.Get, "/accounts"),
+		newTestRule("get-account", common.Get, "/accounts/{#id}"),
+		newTestRule("get-current-account", common.Get, "/accounts/me"),
+		newTestRule("get-account-transactions", common.Get, "/accounts/{#id}/transactions"),
+		newTestRule("get-current-account-settings", common.Get, "/accounts/me/settings"),
+		newTestRule("create-account", common.Post, "/accounts"),
+	}
+
+	tests := []struct {
+		name           string
+		method         common.HttpMethod
+		path           string
+		wantTraTName   string
+		wantParameters map[string]interface{}
+	}{
+		{
+			name:           "static path",
+			method:         common.Get,
+			path:           "/accounts",
+			wantTraTName:   "list-accounts",
+			wantParameters: map[string]interface{}{},
+		},
+		{
+			name:           "parameter",
+			method:         common.Get,
+			path:           "/accounts/42",
+			wantTraTName:   "get-account",
+			wantParameters: map[string]interface{}{"id": "42"},
+		},
+		{
+			name:           "static segment beats a parameter",
+			method:         common.Get,
+			path:           "/accounts/me",
+			wantTraTName:   "get-current-account",
+			wantParameters: map[string]interface{}{},
+		},
+		{
+			name:           "backtracking from a static segment without a rule for the rest of the path",
+			method:         common.Get,
+			path:           "/accounts/me/transactions",
+			wantTraTName:   "get-account-transactions",
+			wantParameters: map[string]interface{}{"id": "me"},
+		},
+		{
+			name:           "static segment deeper in the path",
+			method:         common.Get,
+			path:           "/accounts/me/settings",
+			wantTraTName:   "get-current-account-settings",
+			wantParameters: map[string]interface{}{},
+		},
+		{
+			name:           "rules are indexed per method",
+			method:         common.Post,
+			path:           "/accounts",
+			wantTraTName:   "create-account",
+			wantParameters: map[string]interface{}{},
+		},
+		{
+			name:   "no rule for the method",
+			method: common.Post,
+			path:   "/accounts/42",
+		},
+		{
+			name:   "no rule for the path",
+			method: common.Get,
+			path:   "/accounts/42/settings",
+		},
+		{
+			name:   "trailing slash",
+			method: common.Get,
+			path:   "/accounts/",
+		},
+	}
+
+	// The matched rule must not depend on the order in which the rules are indexed.
+	for _, order := range [][]*TraTGenerationRule{rules, reversed(rules)} {
+		indexedTraTsGenerationRules := newIndexedTraTsGenerationRules()
+
+		for _, rule := range order {
+			if err := indexedTraTsGenerationRules.insert(rule); err != nil {
+				t.Fatalf("insert(%s) error = %v", rule.TraTName, err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rule, parameters, ok := indexedTraTsGenerationRules[tt.method].lookup(tt.path, newRequestAttributes(common.RequestDetails{}))
+
+				if tt.wantTraTName == "" {
+					if ok {
+						t.Fatalf("lookup(%s) matched %s, want no match", tt.path, rule.TraTName)
+					}
+
+					return
+				}
+
+				if !ok {
+					t.Fatalf("lookup(%s) matched no rule, want %s", tt.path, tt.wantTraTName)
+				}
+
+				if rule.TraTName != tt.wantTraTName {
+					t.Errorf("lookup(%s) matched %s, want %s", tt.path, rule.TraTName, tt.wantTraTName)
+				}
+
+				if !reflect.DeepEqual(parameters, tt.wantParameters) {
+					t.Errorf("lookup(%s) parameters = %v, want %v", tt.path, parameters, tt.wantParameters)
+				}
+			})
+		}
+	}
+}
+
+func TestRouteTreeInsertAmbiguity(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *TraTGenerationRule
+		rule     *TraTGenerationRule
+		wantErr  bool
+	}{
+		{
+			name:     "same template",
+			existing: newTestRule("a", common.Get, "/accounts/{#id}"),
+			rule:     newTestRule("b", common.Get, "/accounts/{#id}"),
+			wantErr:  true,
+		},
+		{
+			name:     "templates that only differ in their parameter names",
+			existing: newTestRule("a", common.Get, "/accounts/{#id}"),
+			rule:     newTestRule("b", common.Get, "/accounts/{#accountId}"),
+			wantErr:  true,
+		},
+		{
+			name:     "same template for another method",
+			existing: newTestRule("a", common.Get, "/accounts/{#id}"),
+			rule:     newTestRule("b", common.Delete, "/accounts/{#id}"),
+		},
+		{
+			name:     "static segment and parameter",
+			existing: newTestRule("a", common.Get, "/accounts/{#id}"),
+			rule:     newTestRule("b", common.Get, "/accounts/me"),
+		},
+		{
+			name:     "templates of different lengths",
+			existing: newTestRule("a", common.Get, "/accounts/{#id}"),
+			rule:     newTestRule("b", common.Get, "/accounts/{#id}/transactions"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexedTraTsGenerationRules := newIndexedTraTsGenerationRules()
+
+			if err := indexedTraTsGenerationRules.insert(tt.existing); err != nil {
+				t.Fatalf("insert(%s) error = %v", tt.existing.TraTName, err)
+			}
+
+			err := indexedTraTsGenerationRules.insert(tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("insert(%s) error = %v, want error %v", tt.rule.TraTName, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRouteTreeTypedParameters(t *testing.T) {
+	rules := []*TraTGenerationRule{
+		newTestRule("get-order-by-uuid", common.Get, "/orders/{#id:uuid}"),
+		newTestRule("get-order-by-number", common.Get, "/orders/{#id:int}"),
+		newTestRule("get-order-by-name", common.Get, "/orders/{#name}"),
+		newTestRule("get-order-document", common.Get, "/orders/{#id:int}/{#document}.pdf"),
+		newTestRule("get-order-item", common.Get, "/orders/{#id:int}/items/{#sku:regex([A-Z]{3}-[0-9]+)}"),
+		newTestRule("get-price", common.Get, "/prices/{#amount:number}"),
+		newTestRule("get-flag", common.Get, "/flags/{#enabled:bool}"),
+		newTestRule("get-file", common.Get, "/files/{#path*}"),
+		newTestRule("get-file-metadata", common.Get, "/files/{#path*}"),
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		wantTraTName   string
+		wantParameters map[string]interface{}
+	}{
+		{
+			name:           "uuid beats int and string",
+			path:           "/orders/0b9e6a8c-52a4-4bd1-9d1c-2c8a0a3c8e1f",
+			wantTraTName:   "get-order-by-uuid",
+			wantParameters: map[string]interface{}{"id": "0b9e6a8c-52a4-4bd1-9d1c-2c8a0a3c8e1f"},
+		},
+		{
+			name:           "int parameter is converted",
+			path:           "/orders/42",
+			wantTraTName:   "get-order-by-number",
+			wantParameters: map[string]interface{}{"id": int64(42)},
+		},
+		{
+			name:           "value of no type falls back to a string parameter",
+			path:           "/orders/latest",
+			wantTraTName:   "get-order-by-name",
+			wantParameters: map[string]interface{}{"name": "latest"},
+		},
+		{
+			name:           "pattern segment",
+			path:           "/orders/42/invoice.pdf",
+			wantTraTName:   "get-order-document",
+			wantParameters: map[string]interface{}{"id": int64(42), "document": "invoice"},
+		},
+		{
+			name:           "regex constraint",
+			path:           "/orders/42/items/ABC-7",
+			wantTraTName:   "get-order-item",
+			wantParameters: map[string]interface{}{"id": int64(42), "sku": "ABC-7"},
+		},
+		{
+			name: "value not matching the regex constraint",
+			path: "/orders/42/items/abc-7",
+		},
+		{
+			name:           "number parameter is converted",
+			path:           "/prices/9.99",
+			wantTraTName:   "get-price",
+			wantParameters: map[string]interface{}{"amount": 9.99},
+		},
+		{
+			name: "value not matching the number type",
+			path: "/prices/cheap",
+		},
+		{
+			name:           "bool parameter is converted",
+			path:           "/flags/false",
+			wantTraTName:   "get-flag",
+			wantParameters: map[string]interface{}{"enabled": false},
+		},
+		{
+			name:           "wildcard matches the remaining segments",
+			path:           "/files/reports/2024/q1.csv",
+			wantTraTName:   "get-file",
+			wantParameters: map[string]interface{}{"path": "reports/2024/q1.csv"},
+		},
+		{
+			name: "wildcard does not match an empty rest",
+			path: "/files/",
+		},
+	}
+
+	indexedTraTsGenerationRules := newIndexedTraTsGenerationRules()
+
+	for _, rule := range rules {
+		err := indexedTraTsGenerationRules.insert(rule)
+
+		// Two wildcards of the same path are ambiguous.
+		if rule.TraTName == "get-file-metadata" {
+			if err == nil {
+				t.Fatalf("insert(%s) succeeded, want an ambiguity error", rule.TraTName)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("insert(%s) error = %v", rule.TraTName, err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, parameters, ok := indexedTraTsGenerationRules[common.Get].lookup(tt.path, newRequestAttributes(common.RequestDetails{}))
+
+			if tt.wantTraTName == "" {
+				if ok {
+					t.Fatalf("lookup(%s) matched %s, want no match", tt.path, rule.TraTName)
+				}
+
+				return
+			}
+
+			if !ok || rule.TraTName != tt.wantTraTName {
+				t.Fatalf("lookup(%s) = %v, %v, want %s", tt.path, rule, ok, tt.wantTraTName)
+			}
+
+			if !reflect.DeepEqual(parameters, tt.wantParameters) {
+				t.Errorf("lookup(%s) parameters = %#v, want %#v", tt.path, parameters, tt.wantParameters)
+			}
+		})
+	}
+}
+
+func TestCompilePathTemplate(t *testing.T) {
+	tests := []struct {
+		name               string
+		template           string
+		wantParameterNames []string
+		wantErr            bool
+	}{
+		{name: "static", template: "/accounts", wantParameterNames: []string{}},
+		{name: "typed parameters", template: "/orders/{#id:int}/items/{#sku:regex([A-Z]{3})}", wantParameterNames: []string{"id", "sku"}},
+		{name: "pattern segment", template: "/files/{#name}.{#extension}", wantParameterNames: []string{"name", "extension"}},
+		{name: "wildcard", template: "/files/{#path*}", wantParameterNames: []string{"path"}},
+		{name: "relative path", template: "accounts", wantErr: true},
+		{name: "unsupported type", template: "/orders/{#id:date}", wantErr: true},
+		{name: "invalid regex", template: "/orders/{#id:regex([)}", wantErr: true},
+		{name: "duplicate parameter", template: "/orders/{#id}/items/{#id}", wantErr: true},
+		{name: "wildcard before the last segment", template: "/files/{#path*}/metadata", wantErr: true},
+		{name: "wildcard inside a segment", template: "/files/{#path*}.pdf", wantErr: true},
+		{name: "adjacent parameters", template: "/files/{#name}{#extension}", wantErr: true},
+		{name: "parameter without the # prefix", template: "/orders/{id}", wantErr: true},
+		{name: "unclosed parameter", template: "/orders/{#id", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, parameterNames, err := compilePathTemplate(tt.template)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("compilePathTemplate(%s) succeeded, want an error", tt.template)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("compilePathTemplate(%s) error = %v", tt.template, err)
+			}
+
+			if !reflect.DeepEqual(parameterNames, tt.wantParameterNames) {
+				t.Errorf("compilePathTemplate(%s) parameter names = %v, want %v", tt.template, parameterNames, tt.wantParameterNames)
+			}
+		})
+	}
+}
+
+func reversed(rules []*TraTGenerationRule) []*TraTGenerationRule {
+	reversedRules := make([]*TraTGenerationRule, 0, len(rules))
+
+	for i := len(rules) - 1; i >= 0; i-- {
+		reversedRules = append(reversedRules, rules[i])
+	}
+
+	return reversedRules
+}
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -12,28 +13,44 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
 	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/health"
+	"github.com/tokenetes/tokenetes/pkg/keys"
 	"github.com/tokenetes/tokenetes/pkg/logging"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
 	"github.com/tokenetes/tokenetes/pkg/subjecttokenhandler"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
 	"github.com/tokenetes/tokenetes/utils"
 
 	"errors"
-	"regexp"
 	"strings"
 
 	"github.com/tidwall/gjson"
+	"go.uber.org/zap"
 )
 
 type TokenetesConfigToken struct {
-	Issuer   string `json:"issuer"`
-	Audience string `json:"audience"`
-	LifeTime string `json:"lifeTime"`
+	Issuer           string `json:"issuer"`
+	Audience         string `json:"audience"`
+	LifeTime         string `json:"lifeTime"`
+	SigningAlgorithm string `json:"signingAlgorithm,omitempty"`
+}
+
+func (t *TokenetesConfigToken) GetSigningAlgorithm() string {
+	if t == nil || t.SigningAlgorithm == "" {
+		return keys.DEFAULT_SIGNING_ALGORITHM
+	}
+
+	return t.SigningAlgorithm
 }
 
 type TokenetesConfigGenerationRule struct {
-	Token                               *TokenetesConfigToken                 `json:"token"`
-	SubjectTokens                       *subjecttokenhandler.SubjectTokens    `json:"subjectTokens"`
-	AccessEvaluationAPI                 *accessevaluation.AccessEvaluationAPI `json:"accessEvaluationAPI"`
-	TokenGenerationAuthorizedServiceIds []string                              `json:"tokenGenerationAuthorizedServiceIds"`
+	Token                                  *TokenetesConfigToken                 `json:"token"`
+	SubjectTokens                          *subjecttokenhandler.SubjectTokens    `json:"subjectTokens"`
+	AccessEvaluationAPI                    *accessevaluation.AccessEvaluationAPI `json:"accessEvaluationAPI"`
+	TokenGenerationAuthorizedServiceIds    []string                              `json:"tokenGenerationAuthorizedServiceIds"`
+	TokenIntrospectionAuthorizedServiceIds []string                              `json:"tokenIntrospectionAuthorizedServiceIds,omitempty"`
+	NoMatchingRule                         *NoMatchingRule                       `json:"noMatchingRule,omitempty"`
+	ClaimsProjection                       *ClaimsProjection                     `json:"claimsProjection,omitempty"`
 }
 
 type DynamicMap struct {
@@ -53,17 +70,31 @@ type TraTGenerationRule struct {
 	Path             string            `json:"path"`
 	Method           common.HttpMethod `json:"method"`
 	Purp             string            `json:"purp"`
+	PurpAllowlist    []string          `json:"purpAllowlist,omitempty"`
 	AzdMapping       AzdMapping        `json:"azdmapping,omitempty"`
 	AccessEvaluation *DynamicMap       `json:"accessEvaluation,omitempty"`
+	Match            *MatchConditions  `json:"match,omitempty"`
+	// LifeTime, Audience and Issuer override the token settings of the tokenetes config generation rule. The
+	// lifetime is capped at the global one.
+	LifeTime         string            `json:"lifeTime,omitempty"`
+	Audience         string            `json:"audience,omitempty"`
+	Issuer           string            `json:"issuer,omitempty"`
+	ClaimsProjection *ClaimsProjection `json:"claimsProjection,omitempty"`
+	// OnAccessEvaluationUnavailable applies when the access evaluation api is unavailable. Requests fail by default.
+	OnAccessEvaluationUnavailable *AccessEvaluationUnavailable `json:"onAccessEvaluationUnavailable,omitempty"`
+	LocalPolicy                   *LocalPolicy                 `json:"localPolicy,omitempty"`
 }
 
 type AzdMapping map[string]AzdField
 type AzdField struct {
 	Required bool   `json:"required"`
 	Value    string `json:"value"`
+	// Default is used as-is when the value of an optional field is missing; without it the field is omitted.
+	Default   interface{}    `json:"default,omitempty"`
+	Transform []AzdTransform `json:"transform,omitempty"`
 }
 
-type IndexedTraTsGenerationRules map[common.HttpMethod]map[string]*TraTGenerationRule
+type IndexedTraTsGenerationRules map[common.HttpMethod]*routeTree
 
 type GenerationRules struct {
 	TokenetesConfigGenerationRule *TokenetesConfigGenerationRule `json:"tokenetesConfigGenerationRule"`
@@ -83,49 +114,56 @@ type GenerationRulesImp struct {
 	subjectTokenHandlers        *subjecttokenhandler.TokenHandlers
 	accessevaluator             *accessevaluation.AccessEvaluator
 	httpClient                  *http.Client
-	mu                          sync.RWMutex
+	// learningMode is a local setting that enables the NO_MATCHING_RULE_LEARN fallback on this instance.
+	learningMode bool
+	mu           sync.RWMutex
 }
 
-func NewGenerationRulesImp(httpClient *http.Client) *GenerationRulesImp {
-	indexedTraTsGenerationRules := make(IndexedTraTsGenerationRules)
-
-	for _, method := range common.HttpMethodList {
-		indexedTraTsGenerationRules[method] = make(map[string]*TraTGenerationRule)
-	}
-
+func NewGenerationRulesImp(httpClient *http.Client, learningMode bool) *GenerationRulesImp {
 	return &GenerationRulesImp{
 		generationRules:             NewGenerationRules(),
-		indexedTraTsGenerationRules: indexedTraTsGenerationRules,
+		indexedTraTsGenerationRules: newIndexedTraTsGenerationRules(),
 		httpClient:                  httpClient,
+		learningMode:                learningMode,
 	}
 }
 
-// write lock should be taken my method calling indexTraTsGenerationRules.
-func (gri *GenerationRulesImp) indexTraTsGenerationRules() {
-	indexedTraTsGenerationRules := make(IndexedTraTsGenerationRules)
-
-	for _, method := range common.HttpMethodList {
-		indexedTraTsGenerationRules[method] = make(map[string]*TraTGenerationRule)
-	}
-
-	for _, traTGenerationRules := range gri.generationRules.TraTsGenerationRules {
-		indexedTraTsGenerationRules[traTGenerationRules.Method][traTGenerationRules.Path] = traTGenerationRules
-	}
+// write lock should be taken my method calling indexTraTsGenerationRules. Rules that cannot be indexed are
+// dropped, so that the stored rules, the index and the rules hash stay consistent.
+func (gri *GenerationRulesImp) indexTraTsGenerationRules() error {
+	indexedTraTsGenerationRules, indexedRules, err := buildIndexedTraTsGenerationRules(gri.generationRules.TraTsGenerationRules)
 
+	gri.generationRules.TraTsGenerationRules = indexedRules
 	gri.indexedTraTsGenerationRules = indexedTraTsGenerationRules
+
+	return err
 }
 
+// UpsertTraTRule rejects, with a *ValidationError wrapping ErrInvalidTraTRule, a rule that is invalid or matches
+// the same requests as another trat's rule; the current rules are then kept.
 func (gri *GenerationRulesImp) UpsertTraTRule(traTGenerationRule TraTGenerationRule) error {
 	gri.mu.Lock()
 	defer gri.mu.Unlock()
 
-	if _, exist := gri.indexedTraTsGenerationRules[traTGenerationRule.Method]; !exist {
-		return fmt.Errorf("invalid HTTP method: %s", string(traTGenerationRule.Method))
+	traTsGenerationRules := make(map[string]*TraTGenerationRule, len(gri.generationRules.TraTsGenerationRules)+1)
+	for traTName, rule := range gri.generationRules.TraTsGenerationRules {
+		if traTName != traTGenerationRule.TraTName {
+			traTsGenerationRules[traTName] = rule
+		}
 	}
 
-	gri.generationRules.TraTsGenerationRules[traTGenerationRule.TraTName] = &traTGenerationRule
+	// The other rules are indexed first so that a conflict is reported against the upserted rule. Their own
+	// errors were already logged when they were added.
+	indexedTraTsGenerationRules, _, _ := buildIndexedTraTsGenerationRules(traTsGenerationRules)
 
-	gri.indexTraTsGenerationRules()
+	if err := indexedTraTsGenerationRules.insert(&traTGenerationRule); err != nil {
+		return err
+	}
+
+	traTsGenerationRules[traTGenerationRule.TraTName] = &traTGenerationRule
+
+	gri.generationRules.TraTsGenerationRules = traTsGenerationRules
+	gri.indexedTraTsGenerationRules = indexedTraTsGenerationRules
 
 	return nil
 }
@@ -136,28 +174,65 @@ func (gri *GenerationRulesImp) DeleteTrat(tratName string) {
 
 	delete(gri.generationRules.TraTsGenerationRules, tratName)
 
-	gri.indexTraTsGenerationRules()
+	if err := gri.indexTraTsGenerationRules(); err != nil {
+		logging.GetLogger("generation-rules").Error("Some trat generation rules could not be indexed.", zap.Error(err))
+	}
 }
 
-func (gri *GenerationRulesImp) UpdateTokenetesConfigRule(generationTokenetesConfigRule TokenetesConfigGenerationRule) {
+// UpdateTokenetesConfigRule rejects, with a *ValidationError wrapping ErrInvalidTokenetesConfigRule, an invalid
+// rule; the current rule is then kept.
+func (gri *GenerationRulesImp) UpdateTokenetesConfigRule(generationTokenetesConfigRule TokenetesConfigGenerationRule) error {
+	if err := generationTokenetesConfigRule.Validate(); err != nil {
+		return err
+	}
+
 	gri.mu.Lock()
 	defer gri.mu.Unlock()
 
+	if validationError := applySigningAlgorithm(generationTokenetesConfigRule.Token); validationError != nil {
+		return validationError
+	}
+
 	gri.generationRules.TokenetesConfigGenerationRule = &generationTokenetesConfigRule
 
-	if generationTokenetesConfigRule.SubjectTokens == nil {
+	gri.applyTokenetesConfigRule()
+
+	return nil
+}
+
+// write lock should be taken by the function calling applyTokenetesConfigRule.
+func (gri *GenerationRulesImp) applyTokenetesConfigRule() {
+	tokenetesConfigGenerationRule := gri.generationRules.TokenetesConfigGenerationRule
+
+	if tokenetesConfigGenerationRule.SubjectTokens == nil {
 		gri.subjectTokenHandlers = nil
 	} else {
-		gri.subjectTokenHandlers = subjecttokenhandler.NewTokenHandlers(*generationTokenetesConfigRule.SubjectTokens, logging.GetLogger("subject-token-handler"))
+		gri.subjectTokenHandlers = gri.newSubjectTokenHandlers(tokenetesConfigGenerationRule)
 	}
 
-	if generationTokenetesConfigRule.AccessEvaluationAPI == nil {
+	if tokenetesConfigGenerationRule.AccessEvaluationAPI == nil {
 		gri.accessevaluator = nil
 	} else {
-		gri.accessevaluator = accessevaluation.NewAccessEvaluator(*generationTokenetesConfigRule.AccessEvaluationAPI, gri.httpClient, logging.GetLogger("access-evaluator"))
+		gri.accessevaluator = accessevaluation.NewAccessEvaluator(*tokenetesConfigGenerationRule.AccessEvaluationAPI, gri.httpClient, logging.GetLogger("access-evaluator"))
 	}
 }
 
+func (gri *GenerationRulesImp) newSubjectTokenHandlers(tokenetesConfigGenerationRule *TokenetesConfigGenerationRule) *subjecttokenhandler.TokenHandlers {
+	return subjecttokenhandler.NewTokenHandlers(*tokenetesConfigGenerationRule.SubjectTokens, gri.GetIssuers, gri.GetAudiences, logging.GetLogger("subject-token-handler"))
+}
+
+// applySigningAlgorithm switches the signing keys to the algorithm of the token config. A failed switch keeps the
+// current signing keys and rejects the tokenetes config rule, so that the current rule stays in force.
+func applySigningAlgorithm(token *TokenetesConfigToken) *ValidationError {
+	if err := keys.SetAlgorithm(token.GetSigningAlgorithm()); err != nil {
+		logging.GetLogger("keys").Error("Failed to apply signing algorithm; keeping the current signing key.", zap.String("algorithm", token.GetSigningAlgorithm()), zap.Error(err))
+
+		return &ValidationError{kind: ErrInvalidTokenetesConfigRule, FieldErrors: []FieldError{{Field: "token.signingAlgorithm", Message: err.Error()}}}
+	}
+
+	return nil
+}
+
 func (gri *GenerationRulesImp) GetRulesJSON() (json.RawMessage, error) {
 	gri.mu.RLock()
 	defer gri.mu.RUnlock()
@@ -171,76 +246,69 @@ func (gri *GenerationRulesImp) GetRulesJSON() (json.RawMessage, error) {
 }
 
 // Read lock should be take by the function calling matchRule.
-func (gri *GenerationRulesImp) matchRule(path string, method common.HttpMethod) (*TraTGenerationRule, map[string]string, error) {
-	methodRuleMap, ok := gri.indexedTraTsGenerationRules[method]
+func (gri *GenerationRulesImp) matchRule(requestDetails common.RequestDetails) (*TraTGenerationRule, map[string]interface{}, error) {
+	methodRoutes, ok := gri.indexedTraTsGenerationRules[requestDetails.Method]
 	if !ok {
-		return nil, nil, fmt.Errorf("invalid HTTP method: %s", string(method))
+		return nil, nil, fmt.Errorf("%w: invalid HTTP method: %s", tokeneteserrors.ErrInvalidRequestDetails, string(requestDetails.Method))
 	}
 
-	for pattern, rule := range methodRuleMap {
-		regexPattern := convertToRegex(pattern)
-		re := regexp.MustCompile(regexPattern)
-
-		if re.MatchString(path) {
-			matches := re.FindStringSubmatch(path)
-			names := re.SubexpNames()
-
-			pathParameters := make(map[string]string)
+	requestAttributes := newRequestAttributes(requestDetails)
 
-			for i, name := range names {
-				if i != 0 && name != "" {
-					pathParameters[name] = matches[i]
-				}
-			}
-
-			return rule, pathParameters, nil
-		}
+	rule, pathParameters, ok := methodRoutes.lookup(requestDetails.Path, requestAttributes)
+	if requestAttributes.multiValued != "" {
+		return nil, nil, fmt.Errorf("%w: %s has multiple values and conditions a generation rule", tokeneteserrors.ErrInvalidRequestDetails, requestAttributes.multiValued)
 	}
 
-	return nil, nil, errors.New("no matching rule found")
-}
-
-func convertToRegex(template string) string {
-	r := strings.NewReplacer("{#", "(?P<", "}", ">[^/]+)")
+	if !ok {
+		return nil, nil, tokeneteserrors.ErrNoMatchingRule
+	}
 
-	return "^" + r.Replace(template) + "$"
+	return rule, pathParameters, nil
 }
 
-func (gri *GenerationRulesImp) ConstructPurpAndAzd(txnTokenRequest *common.TokenRequest) (string, map[string]interface{}, error) {
-	gri.mu.RLock()
-	defer gri.mu.RUnlock()
+// ConstructPurpAndAzd returns the purp and azd of the txn token issued for the request. A fallback token has the
+// fallback purp and no azd.
+func (mr *MatchedRequest) ConstructPurpAndAzd() (string, map[string]interface{}, error) {
+	if mr.rule == nil {
+		return mr.fallbackPurp, nil, nil
+	}
 
-	path := txnTokenRequest.RequestDetails.Path
-	method := txnTokenRequest.RequestDetails.Method
+	generationTraTRule := mr.rule
+	path := mr.txnTokenRequest.RequestDetails.Path
+	method := mr.txnTokenRequest.RequestDetails.Method
 
 	input := make(map[string]interface{})
-	input["body"] = txnTokenRequest.RequestDetails.Body
-	input["headers"] = txnTokenRequest.RequestDetails.Headers
-	input["queryParameters"] = txnTokenRequest.RequestDetails.QueryParameters
+	input["body"] = mr.txnTokenRequest.RequestDetails.Body
+	input["headers"] = mr.txnTokenRequest.RequestDetails.Headers
+	input["queryParameters"] = mr.txnTokenRequest.RequestDetails.QueryParameters
 
-	generationTraTRule, pathParameter, err := gri.matchRule(path, method)
-	if err != nil {
-		return "", nil, fmt.Errorf("error matching generation rule for %s path and %s method: %w", path, string(method), err)
+	for par, val := range mr.pathParameter {
+		input[par] = val
 	}
 
-	for par, val := range pathParameter {
-		input[par] = val
+	purp, err := resolvePurp(generationTraTRule, input)
+	if err != nil {
+		return "", nil, fmt.Errorf("error resolving purp from generation trat rule for %s path and %s method: %w", path, string(method), err)
 	}
 
 	if generationTraTRule.AzdMapping == nil {
-		return generationTraTRule.Purp, nil, nil
+		return purp, nil, nil
 	}
 
-	azd, err := gri.computeAzd(generationTraTRule.AzdMapping, input)
+	azdComputationStart := time.Now()
+
+	azd, err := computeAzd(generationTraTRule.AzdMapping, input)
+
+	metrics.ObserveStage(metrics.STAGE_AZD_COMPUTATION, azdComputationStart)
+
 	if err != nil {
 		return "", nil, fmt.Errorf("error computing azd from generation trat rule for %s path and %s method: %w", path, string(method), err)
 	}
 
-	return generationTraTRule.Purp, azd, nil
+	return purp, azd, nil
 }
 
-// Read lock should be take by the function calling computeAzd.
-func (gri *GenerationRulesImp) computeAzd(azdMapping AzdMapping, input map[string]interface{}) (map[string]interface{}, error) {
+func computeAzd(azdMapping AzdMapping, input map[string]interface{}) (map[string]interface{}, error) {
 	azd := make(map[string]interface{})
 
 	jsonInput, err := marshalToJson(input)
@@ -248,26 +316,58 @@ func (gri *GenerationRulesImp) computeAzd(azdMapping AzdMapping, input map[strin
 		return nil, fmt.Errorf("failed to marshal input to JSON: %w", err)
 	}
 
+	resolve := func(valueSpec string) (interface{}, bool) {
+		if path, ok := valuePath(valueSpec); ok {
+			value := extractValueFromJson(jsonInput, path)
+
+			return value, value != nil
+		}
+
+		return valueSpec, true
+	}
+
 	for key, azdField := range azdMapping {
-		valueSpec := azdField.Value
+		value, ok := resolve(azdField.Value)
+		if !ok {
+			switch {
+			case azdField.Required:
+				// The client is told which of its request fields is missing, e.g. body.amount.
+				path, _ := valuePath(azdField.Value)
+
+				return nil, fmt.Errorf("%w: no value for azd field %s", tokeneteserrors.ErrMissingRequiredAzdField.WithDetail(path), key)
+			case azdField.Default != nil:
+				azd[key] = azdField.Default
+			}
 
-		if strings.HasPrefix(valueSpec, "${") && strings.HasSuffix(valueSpec, "}") {
-			path := strings.TrimSuffix(strings.TrimPrefix(valueSpec, "${"), "}")
-			value := extractValueFromJson(jsonInput, path)
+			continue
+		}
 
-			if value == nil {
-				return nil, fmt.Errorf("failed to extract value for key %s from path %s", key, path)
+		for _, transform := range azdField.Transform {
+			value, err = transform.apply(value, resolve)
+			if errors.Is(err, errAzdTransform) {
+				return nil, fmt.Errorf("%w: azd field %s: %v", tokeneteserrors.ErrInvalidRequestDetails, key, err)
 			}
 
-			azd[key] = value
-		} else {
-			azd[key] = valueSpec
+			if err != nil {
+				return nil, fmt.Errorf("azd field %s: %w", key, err)
+			}
 		}
+
+		azd[key] = value
 	}
 
 	return azd, nil
 }
 
+// valuePath returns the path of a "${path}" value spec.
+func valuePath(valueSpec string) (string, bool) {
+	if strings.HasPrefix(valueSpec, "${") && strings.HasSuffix(valueSpec, "}") {
+		return strings.TrimSuffix(strings.TrimPrefix(valueSpec, "${"), "}"), true
+	}
+
+	return "", false
+}
+
 func extractValueFromJson(jsonStr string, path string) interface{} {
 	result := gjson.Get(jsonStr, path)
 
@@ -291,6 +391,10 @@ func (gri *GenerationRulesImp) GetIssuer() string {
 	gri.mu.RLock()
 	defer gri.mu.RUnlock()
 
+	if gri.generationRules.TokenetesConfigGenerationRule == nil || gri.generationRules.TokenetesConfigGenerationRule.Token == nil {
+		return ""
+	}
+
 	return gri.generationRules.TokenetesConfigGenerationRule.Token.Issuer
 }
 
@@ -298,13 +402,78 @@ func (gri *GenerationRulesImp) GetAudience() string {
 	gri.mu.RLock()
 	defer gri.mu.RUnlock()
 
+	if gri.generationRules.TokenetesConfigGenerationRule == nil || gri.generationRules.TokenetesConfigGenerationRule.Token == nil {
+		return ""
+	}
+
 	return gri.generationRules.TokenetesConfigGenerationRule.Token.Audience
 }
 
+// GetIssuers returns the global issuer and the issuer overrides of the trat generation rules.
+func (gri *GenerationRulesImp) GetIssuers() []string {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	issuers := make([]string, 0, 1)
+
+	if gri.generationRules.TokenetesConfigGenerationRule != nil && gri.generationRules.TokenetesConfigGenerationRule.Token != nil {
+		issuers = append(issuers, gri.generationRules.TokenetesConfigGenerationRule.Token.Issuer)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, rule := range gri.generationRules.TraTsGenerationRules {
+		if rule.Issuer != "" && !seen[rule.Issuer] {
+			seen[rule.Issuer] = true
+			issuers = append(issuers, rule.Issuer)
+		}
+	}
+
+	return issuers
+}
+
+// GetAudiences returns the global audience and the audience overrides of the trat generation rules.
+func (gri *GenerationRulesImp) GetAudiences() []string {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	audiences := make([]string, 0, 1)
+
+	if gri.generationRules.TokenetesConfigGenerationRule != nil && gri.generationRules.TokenetesConfigGenerationRule.Token != nil {
+		audiences = append(audiences, gri.generationRules.TokenetesConfigGenerationRule.Token.Audience)
+	}
+
+	seen := make(map[string]bool)
+
+	for _, rule := range gri.generationRules.TraTsGenerationRules {
+		if rule.Audience != "" && !seen[rule.Audience] {
+			seen[rule.Audience] = true
+			audiences = append(audiences, rule.Audience)
+		}
+	}
+
+	return audiences
+}
+
+func (gri *GenerationRulesImp) GetSigningAlgorithm() string {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	if gri.generationRules.TokenetesConfigGenerationRule == nil {
+		return keys.DEFAULT_SIGNING_ALGORITHM
+	}
+
+	return gri.generationRules.TokenetesConfigGenerationRule.Token.GetSigningAlgorithm()
+}
+
 func (gri *GenerationRulesImp) GetTokenLifetime() (time.Duration, error) {
 	gri.mu.RLock()
 	defer gri.mu.RUnlock()
 
+	if gri.generationRules.TokenetesConfigGenerationRule == nil || gri.generationRules.TokenetesConfigGenerationRule.Token == nil {
+		return 0, errors.New("token configuration not available")
+	}
+
 	duration, err := time.ParseDuration(gri.generationRules.TokenetesConfigGenerationRule.Token.LifeTime)
 	if err != nil {
 		return 0, fmt.Errorf("error parsing token lifetime: %v", err)
@@ -313,32 +482,186 @@ func (gri *GenerationRulesImp) GetTokenLifetime() (time.Duration, error) {
 	return duration, nil
 }
 
-func (gri *GenerationRulesImp) EvaluateAccess(txnTokenRequest *common.TokenRequest, subjectTokenClaims interface{}) (bool, error) {
-	gri.mu.RLock()
-	defer gri.mu.RUnlock()
+// EvaluateAccess evaluates access to the request for a token with the purp, with the local policy and the access
+// evaluation api of the matching rule. It takes no lock, since the access evaluation api may be slow.
+func (mr *MatchedRequest) EvaluateAccess(ctx context.Context, subjectTokenClaims interface{}, purp string) (bool, error) {
+	// A fallback token has no azd and the access evaluation request mapping is part of the rule, so it is issued
+	// without access evaluation; see NoMatchingRule.
+	if mr.rule == nil {
+		if mr.accessEvaluator != nil && mr.accessEvaluator.IsAccessEvaluationEnabled() {
+			logging.GetLogger("generation-rules").Warn("Issuing a fallback token without access evaluation.",
+				zap.String("path", mr.txnTokenRequest.RequestDetails.Path),
+				zap.String("method", string(mr.txnTokenRequest.RequestDetails.Method)),
+				zap.String("purp", purp))
+		}
 
-	if gri.accessevaluator == nil {
 		return true, nil
 	}
 
-	generationTraTRule, pathParameter, err := gri.matchRule(txnTokenRequest.RequestDetails.Path, txnTokenRequest.RequestDetails.Method)
+	generationTraTRule := mr.rule
+	txnTokenRequest := mr.txnTokenRequest
+	pathParameter := mr.pathParameter
+	accessEvaluator := mr.accessEvaluator
+
+	accessEvaluationEnabled := accessEvaluator != nil && accessEvaluator.IsAccessEvaluationEnabled()
+
+	// While access evaluation is enabled, a rule must either be evaluated by the api or carry a local policy.
+	if accessEvaluationEnabled && generationTraTRule.AccessEvaluation == nil && generationTraTRule.LocalPolicy == nil {
+		return false, fmt.Errorf("trat generation rule %s has no access evaluation mapping while access evaluation is enabled", generationTraTRule.TraTName)
+	}
+
+	remoteEvaluation := accessEvaluationEnabled && generationTraTRule.AccessEvaluation != nil
+
+	if generationTraTRule.LocalPolicy == nil {
+		if !remoteEvaluation {
+			return true, nil
+		}
+
+		return evaluateRemoteAccess(ctx, accessEvaluator, generationTraTRule, txnTokenRequest, subjectTokenClaims, pathParameter, purp)
+	}
+
+	localDecision, err := generationTraTRule.LocalPolicy.evaluate(accessevaluation.NewInput(subjectTokenClaims, txnTokenRequest.RequestDetails, txnTokenRequest.RequestContext, pathParameter))
 	if err != nil {
-		return false, fmt.Errorf("error matching generation rule for %s path and %s method: %w", txnTokenRequest.RequestDetails.Path, string(txnTokenRequest.RequestDetails.Method), err)
+		return false, fmt.Errorf("error evaluating local policy of trat generation rule %s: %w", generationTraTRule.TraTName, err)
+	}
+
+	if !remoteEvaluation {
+		return localDecision, nil
+	}
+
+	switch generationTraTRule.LocalPolicy.combine() {
+	case LOCAL_POLICY_COMBINE_OR:
+		if localDecision {
+			return true, nil
+		}
+	default:
+		if !localDecision {
+			return false, nil
+		}
+	}
+
+	return evaluateRemoteAccess(ctx, accessEvaluator, generationTraTRule, txnTokenRequest, subjectTokenClaims, pathParameter, purp)
+}
+
+func evaluateRemoteAccess(ctx context.Context, accessEvaluator *accessevaluation.AccessEvaluator, generationTraTRule *TraTGenerationRule, txnTokenRequest *common.TokenRequest, subjectTokenClaims interface{}, pathParameter map[string]interface{}, purp string) (bool, error) {
+	decision, err := accessEvaluator.Evaluate(ctx, generationTraTRule.AccessEvaluation.Map, subjectTokenClaims, txnTokenRequest.RequestDetails, txnTokenRequest.RequestContext, pathParameter)
+	if errors.Is(err, tokeneteserrors.ErrAccessEvaluationUnavailable) && generationTraTRule.OnAccessEvaluationUnavailable.allows(purp) {
+		logging.GetLogger("generation-rules").Warn("Access evaluation api is unavailable; allowing the request as configured by its trat generation rule.",
+			zap.String("trat-name", generationTraTRule.TraTName),
+			zap.String("purp", purp),
+			zap.Error(err))
+
+		return true, nil
 	}
 
-	return gri.accessevaluator.Evaluate(generationTraTRule.AccessEvaluation.Map, subjectTokenClaims, txnTokenRequest.RequestDetails, txnTokenRequest.RequestContext, pathParameter)
+	return decision, err
 }
 
 func (gri *GenerationRulesImp) GetSubjectTokenHandler(tokenType common.TokenType) (subjecttokenhandler.TokenHandler, error) {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	if gri.subjectTokenHandlers == nil {
+		return nil, fmt.Errorf("%w: subject tokens are not configured", tokeneteserrors.ErrUnsupportedTokenType)
+	}
+
 	return gri.subjectTokenHandlers.GetHandler(tokenType)
 }
 
+func (gri *GenerationRulesImp) GetSupportedSubjectTokenTypes() []common.TokenType {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	if gri.subjectTokenHandlers == nil {
+		return []common.TokenType{}
+	}
+
+	return gri.subjectTokenHandlers.GetSupportedTokenTypes()
+}
+
+// GetTxnTokenHandler returns the handler verifying txn tokens issued by this service. Without a txn subject token
+// configuration only this instance's keys are trusted.
+func (gri *GenerationRulesImp) GetTxnTokenHandler() subjecttokenhandler.TokenHandler {
+	if txnTokenHandler, err := gri.GetSubjectTokenHandler(common.TXN_TOKEN_TYPE); err == nil {
+		return txnTokenHandler
+	}
+
+	return subjecttokenhandler.NewTxnTokenHandler(&subjecttokenhandler.TxnToken{}, gri.GetIssuers, gri.GetAudiences, logging.GetLogger("subject-token-handler"))
+}
+
+// CheckTokenConfig checks that the token issuer and lifetime are configured, as required to issue tokens.
+func (gri *GenerationRulesImp) CheckTokenConfig(_ context.Context) error {
+	if gri.GetIssuer() == "" {
+		return errors.New("token issuer is not configured")
+	}
+
+	tokenLifetime, err := gri.GetTokenLifetime()
+	if err != nil {
+		return err
+	}
+
+	if tokenLifetime <= 0 {
+		return errors.New("token lifetime must be positive")
+	}
+
+	return nil
+}
+
+func (gri *GenerationRulesImp) CheckSubjectTokenHandlers(_ context.Context) error {
+	if len(gri.GetSupportedSubjectTokenTypes()) == 0 {
+		return errors.New("no subject token handlers are configured")
+	}
+
+	return nil
+}
+
+func (gri *GenerationRulesImp) CheckOIDCProvider(ctx context.Context) error {
+	gri.mu.RLock()
+	subjectTokenHandlers := gri.subjectTokenHandlers
+	gri.mu.RUnlock()
+
+	if subjectTokenHandlers == nil {
+		return health.ErrNotConfigured
+	}
+
+	return subjectTokenHandlers.CheckOIDCProvider(ctx)
+}
+
+func (gri *GenerationRulesImp) CheckAccessEvaluationAPI(ctx context.Context) error {
+	gri.mu.RLock()
+	accessEvaluator := gri.accessevaluator
+	gri.mu.RUnlock()
+
+	if accessEvaluator == nil || !accessEvaluator.IsAccessEvaluationEnabled() {
+		return health.ErrNotConfigured
+	}
+
+	return accessEvaluator.CheckEndpoint(ctx)
+}
+
 func (gri *GenerationRulesImp) GetTokenGenerationAuthorizedServiceIds() ([]spiffeid.ID, error) {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
+	if gri.generationRules.TokenetesConfigGenerationRule == nil {
+		return []spiffeid.ID{}, nil
+	}
+
+	return parseSpiffeIDs(gri.generationRules.TokenetesConfigGenerationRule.TokenGenerationAuthorizedServiceIds)
+}
+
+func (gri *GenerationRulesImp) GetTokenIntrospectionAuthorizedServiceIds() ([]spiffeid.ID, error) {
+	gri.mu.RLock()
+	defer gri.mu.RUnlock()
+
 	if gri.generationRules.TokenetesConfigGenerationRule == nil {
 		return []spiffeid.ID{}, nil
 	}
 
-	stringIDs := gri.generationRules.TokenetesConfigGenerationRule.TokenGenerationAuthorizedServiceIds
+	return parseSpiffeIDs(gri.generationRules.TokenetesConfigGenerationRule.TokenIntrospectionAuthorizedServiceIds)
+}
+
+func parseSpiffeIDs(stringIDs []string) ([]spiffeid.ID, error) {
 	spiffeIDs := make([]spiffeid.ID, 0, len(stringIDs))
 
 	for _, idStr := range stringIDs {
@@ -353,27 +676,61 @@ func (gri *GenerationRulesImp) GetTokenGenerationAuthorizedServiceIds() ([]spiff
 	return spiffeIDs, nil
 }
 
-func (gri *GenerationRulesImp) UpdateCompleteRules(generationRules *GenerationRules) {
+// UpdateCompleteRules replaces the generation rules and returns the rejected rules as ValidationErrors. Only
+// accepted rules are stored, so that the stored rules, their index and the rules hash describe the same state:
+// a trat rule that is invalid or conflicts with another rule is rejected and its trat keeps the current rule, as
+// with UpsertTraTRule, unless that conflicts with the accepted rules. An invalid tokenetes config rule, or one
+// whose signing algorithm cannot be applied, rejects the whole update, keeping the current rules.
+func (gri *GenerationRulesImp) UpdateCompleteRules(generationRules *GenerationRules) error {
+	if generationRules.TokenetesConfigGenerationRule != nil {
+		if err := generationRules.TokenetesConfigGenerationRule.Validate(); err != nil {
+			var validationError *ValidationError
+			if errors.As(err, &validationError) {
+				return ValidationErrors{validationError}
+			}
+
+			return err
+		}
+	}
+
 	gri.mu.Lock()
 	defer gri.mu.Unlock()
 
-	gri.generationRules = generationRules
-
-	if gri.generationRules.TokenetesConfigGenerationRule != nil {
-		if gri.generationRules.TokenetesConfigGenerationRule.SubjectTokens == nil {
-			gri.subjectTokenHandlers = nil
-		} else {
-			gri.subjectTokenHandlers = subjecttokenhandler.NewTokenHandlers(*gri.generationRules.TokenetesConfigGenerationRule.SubjectTokens, logging.GetLogger("subject-token-handler"))
+	if generationRules.TokenetesConfigGenerationRule != nil {
+		if validationError := applySigningAlgorithm(generationRules.TokenetesConfigGenerationRule.Token); validationError != nil {
+			return ValidationErrors{validationError}
 		}
+	}
+
+	indexedTraTsGenerationRules, indexedRules, err := buildIndexedTraTsGenerationRules(generationRules.TraTsGenerationRules)
+
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		for _, validationError := range validationErrors {
+			currentRule, ok := gri.generationRules.TraTsGenerationRules[validationError.Rule]
+			if !ok {
+				continue
+			}
+
+			if insertErr := indexedTraTsGenerationRules.insert(currentRule); insertErr != nil {
+				logging.GetLogger("generation-rules").Error("Current trat generation rule conflicts with the updated rules; dropping it.", zap.String("trat", validationError.Rule), zap.Error(insertErr))
+
+				continue
+			}
 
-		if gri.generationRules.TokenetesConfigGenerationRule.AccessEvaluationAPI == nil {
-			gri.accessevaluator = nil
-		} else {
-			gri.accessevaluator = accessevaluation.NewAccessEvaluator(*gri.generationRules.TokenetesConfigGenerationRule.AccessEvaluationAPI, gri.httpClient, logging.GetLogger("access-evaluator"))
+			indexedRules[validationError.Rule] = currentRule
 		}
 	}
 
-	gri.indexTraTsGenerationRules()
+	gri.generationRules = generationRules
+	gri.generationRules.TraTsGenerationRules = indexedRules
+	gri.indexedTraTsGenerationRules = indexedTraTsGenerationRules
+
+	if gri.generationRules.TokenetesConfigGenerationRule != nil {
+		gri.applyTokenetesConfigRule()
+	}
+
+	return err
 }
 
 func (generationRules *GenerationRules) ComputeStableHash() (string, error) {
@@ -0,0 +1,190 @@
+package v1alpha1
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/keys"
+)
+
+// initializeKeys starts the test with ephemeral RS256 signing keys, or with the keys of a directory, and restores
+// ephemeral RS256 keys afterwards.
+func initializeKeys(t *testing.T, config keys.Config) {
+	t.Helper()
+
+	reset := func() {
+		if err := keys.Initialize(keys.Config{}); err != nil {
+			t.Fatalf("keys.Initialize() error = %v", err)
+		}
+
+		if err := keys.SetAlgorithm(keys.DEFAULT_SIGNING_ALGORITHM); err != nil {
+			t.Fatalf("keys.SetAlgorithm() error = %v", err)
+		}
+	}
+
+	reset()
+	t.Cleanup(reset)
+
+	if err := keys.Initialize(config); err != nil {
+		t.Fatalf("keys.Initialize() error = %v", err)
+	}
+}
+
+func newTestTokenetesConfigRuleWithAlgorithm(signingAlgorithm string) *TokenetesConfigGenerationRule {
+	rule := newTestTokenetesConfigRule()
+	rule.Token.SigningAlgorithm = signingAlgorithm
+
+	return rule
+}
+
+func TestUpdateTokenetesConfigRuleSwitchesSigningAlgorithm(t *testing.T) {
+	initializeKeys(t, keys.Config{})
+
+	gri := NewGenerationRulesImp(nil, false)
+
+	tests := []struct {
+		signingAlgorithm string
+		wantAlgorithm    string
+		wantKeyType      string
+	}{
+		{signingAlgorithm: keys.PS256, wantAlgorithm: keys.PS256, wantKeyType: "RSA"},
+		{signingAlgorithm: keys.ES256, wantAlgorithm: keys.ES256, wantKeyType: "EC"},
+		{signingAlgorithm: keys.EdDSA, wantAlgorithm: keys.EdDSA, wantKeyType: "OKP"},
+		{signingAlgorithm: keys.RS256, wantAlgorithm: keys.RS256, wantKeyType: "RSA"},
+		{signingAlgorithm: "", wantAlgorithm: keys.RS256, wantKeyType: "RSA"},
+	}
+
+	// The steps run in order, each switching from the algorithm of the step before.
+	for _, tt := range tests {
+		previousKid := keys.GetKid()
+
+		if err := gri.UpdateTokenetesConfigRule(*newTestTokenetesConfigRuleWithAlgorithm(tt.signingAlgorithm)); err != nil {
+			t.Fatalf("%q: UpdateTokenetesConfigRule() error = %v", tt.signingAlgorithm, err)
+		}
+
+		kid, algorithm, _ := keys.GetSigningKey()
+		if algorithm != tt.wantAlgorithm {
+			t.Errorf("%q: signing algorithm = %s, want %s", tt.signingAlgorithm, algorithm, tt.wantAlgorithm)
+		}
+
+		publicKey, ok := keys.GetJWKS().LookupKeyID(kid)
+		if !ok {
+			t.Fatalf("%q: signing kid %s is not published", tt.signingAlgorithm, kid)
+		}
+
+		if publicKey.KeyType().String() != tt.wantKeyType || publicKey.Algorithm() != tt.wantAlgorithm {
+			t.Errorf("%q: published kty = %s, alg = %s, want %s, %s", tt.signingAlgorithm, publicKey.KeyType(), publicKey.Algorithm(), tt.wantKeyType, tt.wantAlgorithm)
+		}
+
+		// Tokens signed before the switch stay verifiable.
+		if tt.signingAlgorithm != "" {
+			if _, ok := keys.GetJWKS().LookupKeyID(previousKid); !ok || kid == previousKid {
+				t.Errorf("%q: previous kid %s is not retired, signing kid = %s", tt.signingAlgorithm, previousKid, kid)
+			}
+		}
+	}
+}
+
+func TestUpdateTokenetesConfigRuleKeepsRuleOnFailedAlgorithmSwitch(t *testing.T) {
+	// The keys directory holds an RSA key only, so ES256 and EdDSA cannot be switched to.
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if err := os.WriteFile(filepath.Join(dir, "signing.pem"), keyPEM, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		update func(gri *GenerationRulesImp, rule *TokenetesConfigGenerationRule) error
+	}{
+		{
+			name: "UpdateTokenetesConfigRule",
+			update: func(gri *GenerationRulesImp, rule *TokenetesConfigGenerationRule) error {
+				return gri.UpdateTokenetesConfigRule(*rule)
+			},
+		},
+		{
+			name: "UpdateCompleteRules",
+			update: func(gri *GenerationRulesImp, rule *TokenetesConfigGenerationRule) error {
+				return gri.UpdateCompleteRules(&GenerationRules{TokenetesConfigGenerationRule: rule, TraTsGenerationRules: map[string]*TraTGenerationRule{}})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, signingAlgorithm := range []string{keys.ES256, keys.EdDSA} {
+			t.Run(tt.name+" "+signingAlgorithm, func(t *testing.T) {
+				initializeKeys(t, keys.Config{KeysDir: dir})
+
+				gri := NewGenerationRulesImp(nil, false)
+
+				currentRule := newTestTokenetesConfigRuleWithAlgorithm(keys.PS256)
+				if err := gri.UpdateTokenetesConfigRule(*currentRule); err != nil {
+					t.Fatalf("UpdateTokenetesConfigRule() error = %v", err)
+				}
+
+				kid := keys.GetKid()
+
+				err := tt.update(gri, newTestTokenetesConfigRuleWithAlgorithm(signingAlgorithm))
+
+				// UpdateCompleteRules reports the rejected config rule as the only entry of ValidationErrors.
+				var validationErrors ValidationErrors
+				if errors.As(err, &validationErrors) && len(validationErrors) == 1 {
+					err = validationErrors[0]
+				}
+
+				if fields := fieldsOf(t, err, ErrInvalidTokenetesConfigRule); len(fields) != 1 || fields[0] != "token.signingAlgorithm" {
+					t.Errorf("update rejected fields %v, want [token.signingAlgorithm]", fields)
+				}
+
+				if got := gri.generationRules.TokenetesConfigGenerationRule.Token.SigningAlgorithm; got != keys.PS256 {
+					t.Errorf("config rule signing algorithm = %s, want %s kept", got, keys.PS256)
+				}
+
+				if newKid, algorithm, _ := keys.GetSigningKey(); newKid != kid || algorithm != keys.PS256 {
+					t.Errorf("signing key = %s, %s, want %s, %s kept", newKid, algorithm, kid, keys.PS256)
+				}
+			})
+		}
+	}
+}
+
+func TestApplySigningAlgorithmKeepsKeysOnFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if err := os.WriteFile(filepath.Join(dir, "signing.pem"), keyPEM, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	initializeKeys(t, keys.Config{KeysDir: dir})
+
+	kid := keys.GetKid()
+
+	// The switch fails past validation, e.g. because the keys directory changed in between.
+	validationError := applySigningAlgorithm(&TokenetesConfigToken{SigningAlgorithm: keys.ES256})
+	if validationError == nil || !errors.Is(validationError, ErrInvalidTokenetesConfigRule) {
+		t.Fatalf("applySigningAlgorithm() error = %v, want %v", validationError, ErrInvalidTokenetesConfigRule)
+	}
+
+	if newKid, algorithm, _ := keys.GetSigningKey(); newKid != kid || algorithm != keys.RS256 {
+		t.Errorf("signing key = %s, %s, want %s, %s kept", newKid, algorithm, kid, keys.RS256)
+	}
+}
@@ -0,0 +1,64 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TokenSettings are the issuer, audience and lifetime of a txn token issued for a request.
+type TokenSettings struct {
+	Issuer   string
+	Audience string
+	LifeTime time.Duration
+}
+
+// resolveTokenSettings returns the token settings of the trat generation rule, or the global ones for a request
+// matching no rule. Settings the rule does not override are the global ones. A rule lifetime longer than the global
+// lifetime is capped at it.
+func resolveTokenSettings(token *TokenetesConfigToken, generationTraTRule *TraTGenerationRule) (TokenSettings, error) {
+	if token == nil {
+		return TokenSettings{}, errors.New("token configuration not available")
+	}
+
+	lifeTime, err := time.ParseDuration(token.LifeTime)
+	if err != nil {
+		return TokenSettings{}, fmt.Errorf("error parsing token lifetime: %v", err)
+	}
+
+	tokenSettings := TokenSettings{
+		Issuer:   token.Issuer,
+		Audience: token.Audience,
+		LifeTime: lifeTime,
+	}
+
+	if generationTraTRule == nil {
+		return tokenSettings, nil
+	}
+
+	if generationTraTRule.Issuer != "" {
+		tokenSettings.Issuer = generationTraTRule.Issuer
+	}
+
+	if generationTraTRule.Audience != "" {
+		tokenSettings.Audience = generationTraTRule.Audience
+	}
+
+	if generationTraTRule.LifeTime != "" {
+		ruleLifeTime, err := time.ParseDuration(generationTraTRule.LifeTime)
+		if err != nil {
+			return TokenSettings{}, fmt.Errorf("error parsing lifetime of trat generation rule %s: %v", generationTraTRule.TraTName, err)
+		}
+
+		if ruleLifeTime < tokenSettings.LifeTime {
+			tokenSettings.LifeTime = ruleLifeTime
+		}
+	}
+
+	return tokenSettings, nil
+}
+
+// TokenSettings returns the issuer, audience and lifetime of the txn token issued for the request.
+func (mr *MatchedRequest) TokenSettings() TokenSettings {
+	return mr.tokenSettings
+}
@@ -0,0 +1,101 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveTokenSettings(t *testing.T) {
+	token := &TokenetesConfigToken{
+		Issuer:   "https://tokenetes.example",
+		Audience: "https://api.example",
+		LifeTime: "5m",
+	}
+
+	globalSettings := TokenSettings{Issuer: "https://tokenetes.example", Audience: "https://api.example", LifeTime: 5 * time.Minute}
+
+	tests := []struct {
+		name    string
+		token   *TokenetesConfigToken
+		rule    *TraTGenerationRule
+		want    TokenSettings
+		wantErr bool
+	}{
+		{
+			name:  "request matching no rule",
+			token: token,
+			want:  globalSettings,
+		},
+		{
+			name:  "rule without overrides",
+			token: token,
+			rule:  &TraTGenerationRule{TraTName: "reports"},
+			want:  globalSettings,
+		},
+		{
+			name:  "shorter rule lifetime",
+			token: token,
+			rule:  &TraTGenerationRule{TraTName: "payments", LifeTime: "30s"},
+			want:  TokenSettings{Issuer: "https://tokenetes.example", Audience: "https://api.example", LifeTime: 30 * time.Second},
+		},
+		{
+			name:  "rule lifetime capped at the global lifetime",
+			token: token,
+			rule:  &TraTGenerationRule{TraTName: "reports", LifeTime: "1h"},
+			want:  globalSettings,
+		},
+		{
+			name:  "rule audience override",
+			token: token,
+			rule:  &TraTGenerationRule{TraTName: "payments", Audience: "https://payments.example"},
+			want:  TokenSettings{Issuer: "https://tokenetes.example", Audience: "https://payments.example", LifeTime: 5 * time.Minute},
+		},
+		{
+			name:  "rule issuer override",
+			token: token,
+			rule:  &TraTGenerationRule{TraTName: "payments", Issuer: "https://payments.tokenetes.example"},
+			want:  TokenSettings{Issuer: "https://payments.tokenetes.example", Audience: "https://api.example", LifeTime: 5 * time.Minute},
+		},
+		{
+			name:  "every setting overridden",
+			token: token,
+			rule: &TraTGenerationRule{
+				TraTName: "payments",
+				Issuer:   "https://payments.tokenetes.example",
+				Audience: "https://payments.example",
+				LifeTime: "30s",
+			},
+			want: TokenSettings{Issuer: "https://payments.tokenetes.example", Audience: "https://payments.example", LifeTime: 30 * time.Second},
+		},
+		{
+			name:    "missing token config",
+			rule:    &TraTGenerationRule{TraTName: "payments", LifeTime: "30s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid global lifetime",
+			token:   &TokenetesConfigToken{Issuer: "https://tokenetes.example", Audience: "https://api.example", LifeTime: "never"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid rule lifetime",
+			token:   token,
+			rule:    &TraTGenerationRule{TraTName: "payments", LifeTime: "never"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenSettings, err := resolveTokenSettings(tt.token, tt.rule)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveTokenSettings() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if tokenSettings != tt.want {
+				t.Errorf("resolveTokenSettings() = %+v, want %+v", tokenSettings, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package v1alpha1
+
+import (
+	"path"
+)
+
+const (
+	// ACCESS_EVALUATION_UNAVAILABLE_DENY fails the request when the access evaluation api is unavailable. It is the
+	// default.
+	ACCESS_EVALUATION_UNAVAILABLE_DENY = "deny"
+	// ACCESS_EVALUATION_UNAVAILABLE_ALLOW issues the token without access evaluation.
+	ACCESS_EVALUATION_UNAVAILABLE_ALLOW = "allow"
+	// ACCESS_EVALUATION_UNAVAILABLE_ALLOW_LISTED_PURPS issues the token without access evaluation only if its purp
+	// matches one of the listed purps.
+	ACCESS_EVALUATION_UNAVAILABLE_ALLOW_LISTED_PURPS = "allowListedPurps"
+)
+
+// AccessEvaluationUnavailable configures how the requests of a rule are handled when the access evaluation api
+// cannot be reached, times out, or its circuit breaker is open. Purps are path.Match patterns such as "orders.read*".
+type AccessEvaluationUnavailable struct {
+	Action string   `json:"action"`
+	Purps  []string `json:"purps,omitempty"`
+}
+
+func (u *AccessEvaluationUnavailable) validate(v *validator, field string) {
+	switch u.Action {
+	case ACCESS_EVALUATION_UNAVAILABLE_DENY, ACCESS_EVALUATION_UNAVAILABLE_ALLOW:
+	case ACCESS_EVALUATION_UNAVAILABLE_ALLOW_LISTED_PURPS:
+		if len(u.Purps) == 0 {
+			v.add(field+".purps", "must not be empty for the %s action", ACCESS_EVALUATION_UNAVAILABLE_ALLOW_LISTED_PURPS)
+		}
+	default:
+		v.add(field+".action", "unsupported action %q", u.Action)
+	}
+
+	for i, pattern := range u.Purps {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.add(field+".purps", "invalid purp pattern %d %s: %v", i, pattern, err)
+		}
+	}
+}
+
+// allows reports whether a token with the purp may be issued while the access evaluation api is unavailable.
+func (u *AccessEvaluationUnavailable) allows(purp string) bool {
+	if u == nil {
+		return false
+	}
+
+	switch u.Action {
+	case ACCESS_EVALUATION_UNAVAILABLE_ALLOW:
+		return true
+	case ACCESS_EVALUATION_UNAVAILABLE_ALLOW_LISTED_PURPS:
+		for _, pattern := range u.Purps {
+			if matched, _ := path.Match(pattern, purp); matched {
+				return true
+			}
+		}
+
+		return false
+	default:
+		return false
+	}
+}
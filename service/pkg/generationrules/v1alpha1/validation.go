@@ -0,0 +1,417 @@
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/keys"
+)
+
+var (
+	ErrInvalidTraTRule            = errors.New("invalid trat generation rule")
+	ErrInvalidTokenetesConfigRule = errors.New("invalid tokenetes config generation rule")
+)
+
+// FieldError describes a problem with one field of a rule. Field is the JSON path of the field, e.g.
+// "azdmapping.amount.transform[0].to".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a rule. It wraps ErrInvalidTraTRule or
+// ErrInvalidTokenetesConfigRule.
+type ValidationError struct {
+	kind        error
+	Rule        string       `json:"rule,omitempty"`
+	FieldErrors []FieldError `json:"fieldErrors"`
+}
+
+func (e *ValidationError) Error() string {
+	fieldErrors := make([]string, 0, len(e.FieldErrors))
+	for _, fieldError := range e.FieldErrors {
+		fieldErrors = append(fieldErrors, fieldError.Field+": "+fieldError.Message)
+	}
+
+	if e.Rule == "" {
+		return fmt.Sprintf("%v: %s", e.kind, strings.Join(fieldErrors, "; "))
+	}
+
+	return fmt.Sprintf("%v: %s: %s", e.kind, e.Rule, strings.Join(fieldErrors, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.kind
+}
+
+// ValidationErrors lists the rules rejected from a complete update of the generation rules.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	validationErrors := make([]string, 0, len(e))
+	for _, validationError := range e {
+		validationErrors = append(validationErrors, validationError.Error())
+	}
+
+	return strings.Join(validationErrors, "\n")
+}
+
+type validator struct {
+	fieldErrors []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...interface{}) {
+	v.fieldErrors = append(v.fieldErrors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.add(field, "%v", err)
+	}
+}
+
+func (v *validator) err(kind error, rule string) error {
+	if len(v.fieldErrors) == 0 {
+		return nil
+	}
+
+	return &ValidationError{kind: kind, Rule: rule, FieldErrors: v.fieldErrors}
+}
+
+func newTraTRuleError(rule string, field string, err error) *ValidationError {
+	return &ValidationError{kind: ErrInvalidTraTRule, Rule: rule, FieldErrors: []FieldError{{Field: field, Message: err.Error()}}}
+}
+
+// Validate checks the rule on its own; conflicts with other rules are detected when it is indexed.
+func (r *TraTGenerationRule) Validate() error {
+	var v validator
+
+	if r.TraTName == "" {
+		v.add("traTName", "must not be empty")
+	}
+
+	if !isKnownMethod(r.Method) {
+		v.add("method", "invalid HTTP method %q", string(r.Method))
+	}
+
+	_, parameterNames, pathErr := compilePathTemplate(r.Path)
+	if pathErr != nil {
+		v.add("path", "invalid path template %q: %v", r.Path, pathErr)
+	}
+
+	// Path parameters are top-level fields of the input document, next to the request and the subject token.
+	for _, parameterName := range parameterNames {
+		if slices.Contains(localPolicyVariables, parameterName) {
+			v.add("path", "path parameter name %q is reserved", parameterName)
+		}
+	}
+
+	if r.Purp == "" {
+		v.add("purp", "must not be empty")
+	}
+
+	v.check("purp", validatePurp(r.Purp, r.PurpAllowlist))
+
+	for key, azdField := range r.AzdMapping {
+		field := "azdmapping." + key
+
+		v.check(field+".value", validateReference(azdField.Value))
+
+		for i, transform := range azdField.Transform {
+			transformField := fmt.Sprintf("%s.transform[%d]", field, i)
+
+			v.check(transformField, transform.validate())
+
+			for j, value := range transform.Values {
+				v.check(fmt.Sprintf("%s.values[%d]", transformField, j), validateReference(value))
+			}
+		}
+	}
+
+	if r.AccessEvaluation != nil {
+		validateReferences(&v, "accessEvaluation", r.AccessEvaluation.Map)
+	}
+
+	if r.LifeTime != "" {
+		if lifeTime, err := time.ParseDuration(r.LifeTime); err != nil {
+			v.add("lifeTime", "invalid duration %q: %v", r.LifeTime, err)
+		} else if lifeTime <= 0 {
+			v.add("lifeTime", "must be positive")
+		}
+	}
+
+	if r.ClaimsProjection != nil {
+		r.ClaimsProjection.validate(&v, "claimsProjection")
+	}
+
+	if r.OnAccessEvaluationUnavailable != nil {
+		r.OnAccessEvaluationUnavailable.validate(&v, "onAccessEvaluationUnavailable")
+	}
+
+	// The local policy is compiled here, so that it is compiled once when the rule is upserted.
+	if localPolicy := r.LocalPolicy; localPolicy != nil {
+		switch localPolicy.Combine {
+		case "", LOCAL_POLICY_COMBINE_AND, LOCAL_POLICY_COMBINE_OR:
+		default:
+			v.add("localPolicy.combine", "unsupported combination %q", localPolicy.Combine)
+		}
+
+		if localPolicy.Expression == "" {
+			v.add("localPolicy.expression", "must not be empty")
+		} else if pathErr == nil {
+			v.check("localPolicy.expression", localPolicy.compile(parameterNames))
+		}
+	}
+
+	if r.Match != nil {
+		for name := range r.Match.QueryParameters {
+			if name == "" {
+				v.add("match.queryParameters", "parameter name must not be empty")
+			}
+		}
+
+		for name := range r.Match.Headers {
+			if name == "" {
+				v.add("match.headers", "header name must not be empty")
+			}
+		}
+	}
+
+	return v.err(ErrInvalidTraTRule, r.TraTName)
+}
+
+func (r *TokenetesConfigGenerationRule) Validate() error {
+	var v validator
+
+	if r.Token == nil {
+		v.add("token", "must be set")
+	} else {
+		if r.Token.Issuer == "" {
+			v.add("token.issuer", "must not be empty")
+		}
+
+		if r.Token.Audience == "" {
+			v.add("token.audience", "must not be empty")
+		}
+
+		if lifeTime, err := time.ParseDuration(r.Token.LifeTime); err != nil {
+			v.add("token.lifeTime", "invalid duration %q: %v", r.Token.LifeTime, err)
+		} else if lifeTime <= 0 {
+			v.add("token.lifeTime", "must be positive")
+		}
+
+		if r.Token.SigningAlgorithm != "" && !keys.IsSupportedAlgorithm(r.Token.SigningAlgorithm) {
+			v.add("token.signingAlgorithm", "unsupported signing algorithm %q, supported: %s", r.Token.SigningAlgorithm, strings.Join(keys.SupportedSigningAlgorithms, ", "))
+		} else {
+			v.check("token.signingAlgorithm", keys.CheckAlgorithm(r.Token.GetSigningAlgorithm()))
+		}
+	}
+
+	if r.SubjectTokens != nil {
+		if oidc := r.SubjectTokens.OIDC; oidc != nil {
+			if oidc.ClientID == "" {
+				v.add("subjectTokens.OIDC.clientId", "must not be empty")
+			}
+
+			v.check("subjectTokens.OIDC.providerURL", validateURL(oidc.ProviderURL))
+
+			if oidc.SubjectField == "" {
+				v.add("subjectTokens.OIDC.subjectField", "must not be empty")
+			}
+		}
+
+		if selfSigned := r.SubjectTokens.SelfSigned; selfSigned != nil && selfSigned.Validation {
+			v.check("subjectTokens.selfSigned.jwksEndpoint", validateURL(selfSigned.JWKSSEndpoint))
+		}
+
+		if txnToken := r.SubjectTokens.TxnToken; txnToken != nil {
+			for i, endpoint := range txnToken.PeerJWKSEndpoints {
+				v.check(fmt.Sprintf("subjectTokens.txnToken.peerJwksEndpoints[%d]", i), validateURL(endpoint))
+			}
+		}
+	}
+
+	if api := r.AccessEvaluationAPI; api != nil && api.EnableAccessEvaluation {
+		v.check("accessEvaluationAPI.endpoint", validateURL(api.Endpoint))
+
+		if api.Authentication.Method != "" && api.Authentication.Method != "Bearer" {
+			v.add("accessEvaluationAPI.authentication.method", "unsupported authentication method %q", api.Authentication.Method)
+		}
+
+		switch api.Format {
+		case "", accessevaluation.ACCESS_EVALUATION_FORMAT_GENERIC, accessevaluation.ACCESS_EVALUATION_FORMAT_AUTHZEN:
+		case accessevaluation.ACCESS_EVALUATION_FORMAT_OPA:
+			if api.Package == "" {
+				v.add("accessEvaluationAPI.package", "must not be empty for the %s format", accessevaluation.ACCESS_EVALUATION_FORMAT_OPA)
+			}
+		default:
+			v.add("accessEvaluationAPI.format", "unsupported format %q", api.Format)
+		}
+
+		if decisionCache := api.DecisionCache; decisionCache != nil {
+			validateDuration(&v, "accessEvaluationAPI.decisionCache.permitTTL", decisionCache.PermitTTL)
+			validateDuration(&v, "accessEvaluationAPI.decisionCache.denyTTL", decisionCache.DenyTTL)
+
+			if decisionCache.MaxEntries < 0 {
+				v.add("accessEvaluationAPI.decisionCache.maxEntries", "must not be negative")
+			}
+		}
+
+		if api.Timeout != "" {
+			if timeout, err := time.ParseDuration(api.Timeout); err != nil {
+				v.add("accessEvaluationAPI.timeout", "invalid duration %q: %v", api.Timeout, err)
+			} else if timeout <= 0 {
+				v.add("accessEvaluationAPI.timeout", "must be positive")
+			}
+		}
+
+		if retry := api.Retry; retry != nil {
+			if retry.MaxAttempts < 0 {
+				v.add("accessEvaluationAPI.retry.maxAttempts", "must not be negative")
+			}
+
+			validateDuration(&v, "accessEvaluationAPI.retry.initialBackoff", retry.InitialBackoff)
+			validateDuration(&v, "accessEvaluationAPI.retry.maxBackoff", retry.MaxBackoff)
+		}
+
+		if circuitBreaker := api.CircuitBreaker; circuitBreaker != nil {
+			if circuitBreaker.FailureThreshold < 0 {
+				v.add("accessEvaluationAPI.circuitBreaker.failureThreshold", "must not be negative")
+			}
+
+			validateDuration(&v, "accessEvaluationAPI.circuitBreaker.openDuration", circuitBreaker.OpenDuration)
+		}
+	}
+
+	for i, id := range r.TokenGenerationAuthorizedServiceIds {
+		if _, err := spiffeid.FromString(id); err != nil {
+			v.add(fmt.Sprintf("tokenGenerationAuthorizedServiceIds[%d]", i), "invalid SPIFFE ID %q: %v", id, err)
+		}
+	}
+
+	for i, id := range r.TokenIntrospectionAuthorizedServiceIds {
+		if _, err := spiffeid.FromString(id); err != nil {
+			v.add(fmt.Sprintf("tokenIntrospectionAuthorizedServiceIds[%d]", i), "invalid SPIFFE ID %q: %v", id, err)
+		}
+	}
+
+	if noMatchingRule := r.NoMatchingRule; noMatchingRule != nil {
+		switch noMatchingRule.Action {
+		case NO_MATCHING_RULE_DENY, NO_MATCHING_RULE_LEARN:
+		case NO_MATCHING_RULE_GENERIC:
+			if noMatchingRule.Purp == "" {
+				v.add("noMatchingRule.purp", "must not be empty for the %s action", NO_MATCHING_RULE_GENERIC)
+			}
+		default:
+			v.add("noMatchingRule.action", "unsupported action %q", noMatchingRule.Action)
+		}
+	}
+
+	if r.ClaimsProjection != nil {
+		r.ClaimsProjection.validate(&v, "claimsProjection")
+	}
+
+	return v.err(ErrInvalidTokenetesConfigRule, "")
+}
+
+func isKnownMethod(method common.HttpMethod) bool {
+	for _, knownMethod := range common.HttpMethodList {
+		if method == knownMethod {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateReference checks a value that is either a literal or a single ${...} reference to the input document.
+func validateReference(value string) error {
+	if !strings.Contains(value, "${") {
+		return nil
+	}
+
+	if !strings.HasPrefix(value, "${") || !strings.HasSuffix(value, "}") {
+		return fmt.Errorf("malformed expression %q: a ${...} reference must be the whole value", value)
+	}
+
+	referencePath := strings.TrimSuffix(strings.TrimPrefix(value, "${"), "}")
+	if referencePath == "" || strings.Contains(referencePath, "${") {
+		return fmt.Errorf("malformed expression %q", value)
+	}
+
+	return nil
+}
+
+func validateReferences(v *validator, field string, value interface{}) {
+	switch val := value.(type) {
+	case string:
+		v.check(field, validateReference(val))
+	case map[string]interface{}:
+		for key, item := range val {
+			validateReferences(v, field+"."+key, item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			validateReferences(v, fmt.Sprintf("%s[%d]", field, i), item)
+		}
+	}
+}
+
+func validateDuration(v *validator, field string, value string) {
+	if value == "" {
+		return
+	}
+
+	if duration, err := time.ParseDuration(value); err != nil {
+		v.add(field, "invalid duration %q: %v", value, err)
+	} else if duration < 0 {
+		v.add(field, "must not be negative")
+	}
+}
+
+func validateURL(rawURL string) error {
+	if rawURL == "" {
+		return errors.New("must not be empty")
+	}
+
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+
+	if parsedURL.Scheme == "" || parsedURL.Host == "" {
+		return fmt.Errorf("invalid URL %q: scheme and host are required", rawURL)
+	}
+
+	return nil
+}
+
+// validatePurp checks the references of a templated purp. A templated purp needs an allowlist, so that callers
+// cannot inject arbitrary purposes.
+func validatePurp(purp string, purpAllowlist []string) error {
+	for _, pattern := range purpAllowlist {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid purp allowlist pattern %s: %w", pattern, err)
+		}
+	}
+
+	if !isTemplatedPurp(purp) {
+		return nil
+	}
+
+	if len(purpAllowlist) == 0 {
+		return errors.New("templated purp requires a purp allowlist")
+	}
+
+	_, err := expandPurp(purp, func(string) (string, error) { return "", nil })
+
+	return err
+}
@@ -0,0 +1,374 @@
+package v1alpha1
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/tokenetes/tokenetes/pkg/accessevaluation"
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+// fieldsOf returns the sorted fields of the field errors of a *ValidationError, or nil for a nil error.
+func fieldsOf(t *testing.T, err error, kind error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var validationError *ValidationError
+	if !errors.As(err, &validationError) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+
+	if !errors.Is(err, kind) {
+		t.Errorf("error = %v, want %v", err, kind)
+	}
+
+	fields := make([]string, 0, len(validationError.FieldErrors))
+	for _, fieldError := range validationError.FieldErrors {
+		fields = append(fields, fieldError.Field)
+	}
+
+	slices.Sort(fields)
+
+	return fields
+}
+
+func TestTraTGenerationRuleValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       func(rule *TraTGenerationRule)
+		wantFields []string
+	}{
+		{
+			name: "valid rule",
+			rule: func(rule *TraTGenerationRule) {},
+		},
+		{
+			name: "missing name, method and purp",
+			rule: func(rule *TraTGenerationRule) {
+				rule.TraTName = ""
+				rule.Method = "FETCH"
+				rule.Purp = ""
+			},
+			wantFields: []string{"method", "purp", "traTName"},
+		},
+		{
+			name:       "invalid path template",
+			rule:       func(rule *TraTGenerationRule) { rule.Path = "/accounts/{#id" },
+			wantFields: []string{"path"},
+		},
+		{
+			name:       "reserved path parameter name",
+			rule:       func(rule *TraTGenerationRule) { rule.Path = "/accounts/{#body}" },
+			wantFields: []string{"path"},
+		},
+		{
+			name:       "templated purp without an allowlist",
+			rule:       func(rule *TraTGenerationRule) { rule.Purp = "accounts.${request.body.operation}" },
+			wantFields: []string{"purp"},
+		},
+		{
+			name: "malformed azd references and transforms",
+			rule: func(rule *TraTGenerationRule) {
+				rule.AzdMapping = AzdMapping{
+					"amount": {Value: "amount: ${request.body.amount}"},
+					"name": {
+						Value: "${request.body.name}",
+						Transform: []AzdTransform{
+							{Type: AZD_TRANSFORM_CAST, To: "date"},
+							{Type: AZD_TRANSFORM_CONCAT, Values: []string{"${}"}},
+						},
+					},
+				}
+			},
+			wantFields: []string{"azdmapping.amount.value", "azdmapping.name.transform[0]", "azdmapping.name.transform[1].values[0]"},
+		},
+		{
+			name: "malformed access evaluation reference",
+			rule: func(rule *TraTGenerationRule) {
+				rule.AccessEvaluation = &DynamicMap{Map: map[string]interface{}{
+					"resource": map[string]interface{}{"id": "${request.body.id"},
+				}}
+			},
+			wantFields: []string{"accessEvaluation.resource.id"},
+		},
+		{
+			name:       "invalid lifetime",
+			rule:       func(rule *TraTGenerationRule) { rule.LifeTime = "-1m" },
+			wantFields: []string{"lifeTime"},
+		},
+		{
+			name: "local policy that does not compile",
+			rule: func(rule *TraTGenerationRule) {
+				rule.LocalPolicy = &LocalPolicy{Expression: "body.amount <", Combine: "xor"}
+			},
+			wantFields: []string{"localPolicy.combine", "localPolicy.expression"},
+		},
+		{
+			name: "empty match condition names",
+			rule: func(rule *TraTGenerationRule) {
+				rule.Match = &MatchConditions{QueryParameters: map[string]string{"": "a"}, Headers: map[string]string{"": "b"}}
+			},
+			wantFields: []string{"match.headers", "match.queryParameters"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := newTestRule("get-account", common.Get, "/accounts/{#id}")
+			tt.rule(rule)
+
+			fields := fieldsOf(t, rule.Validate(), ErrInvalidTraTRule)
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func newTestTokenetesConfigRule() *TokenetesConfigGenerationRule {
+	return &TokenetesConfigGenerationRule{
+		Token: &TokenetesConfigToken{
+			Issuer:   "https://tokenetes.example",
+			Audience: "https://api.example",
+			LifeTime: "5m",
+		},
+	}
+}
+
+func TestTokenetesConfigGenerationRuleValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		rule       func(rule *TokenetesConfigGenerationRule)
+		wantFields []string
+	}{
+		{
+			name: "valid rule",
+			rule: func(rule *TokenetesConfigGenerationRule) {},
+		},
+		{
+			name:       "missing token",
+			rule:       func(rule *TokenetesConfigGenerationRule) { rule.Token = nil },
+			wantFields: []string{"token"},
+		},
+		{
+			name: "invalid token",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.Token = &TokenetesConfigToken{LifeTime: "0s", SigningAlgorithm: "HS256"}
+			},
+			wantFields: []string{"token.audience", "token.issuer", "token.lifeTime", "token.signingAlgorithm"},
+		},
+		{
+			name: "invalid access evaluation api",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.AccessEvaluationAPI = &accessevaluation.AccessEvaluationAPI{
+					EnableAccessEvaluation: true,
+					Endpoint:               "pdp:8181",
+					Format:                 accessevaluation.ACCESS_EVALUATION_FORMAT_OPA,
+					DecisionCache:          &accessevaluation.DecisionCache{PermitTTL: "soon", MaxEntries: -1},
+					Timeout:                "0s",
+					Retry:                  &accessevaluation.Retry{MaxAttempts: -1, MaxBackoff: "-1s"},
+					CircuitBreaker:         &accessevaluation.CircuitBreaker{FailureThreshold: -1},
+				}
+			},
+			wantFields: []string{
+				"accessEvaluationAPI.circuitBreaker.failureThreshold",
+				"accessEvaluationAPI.decisionCache.maxEntries",
+				"accessEvaluationAPI.decisionCache.permitTTL",
+				"accessEvaluationAPI.endpoint",
+				"accessEvaluationAPI.package",
+				"accessEvaluationAPI.retry.maxAttempts",
+				"accessEvaluationAPI.retry.maxBackoff",
+				"accessEvaluationAPI.timeout",
+			},
+		},
+		{
+			name: "disabled access evaluation api is not validated",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.AccessEvaluationAPI = &accessevaluation.AccessEvaluationAPI{Format: "xacml"}
+			},
+		},
+		{
+			name: "invalid SPIFFE IDs",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.TokenGenerationAuthorizedServiceIds = []string{"spiffe://example.org/gateway", "gateway"}
+				rule.TokenIntrospectionAuthorizedServiceIds = []string{"http://example.org/audit"}
+			},
+			wantFields: []string{"tokenGenerationAuthorizedServiceIds[1]", "tokenIntrospectionAuthorizedServiceIds[0]"},
+		},
+		{
+			name: "generic fallback without a purp",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.NoMatchingRule = &NoMatchingRule{Action: NO_MATCHING_RULE_GENERIC}
+			},
+			wantFields: []string{"noMatchingRule.purp"},
+		},
+		{
+			name: "unsupported fallback action",
+			rule: func(rule *TokenetesConfigGenerationRule) {
+				rule.NoMatchingRule = &NoMatchingRule{Action: "allow"}
+			},
+			wantFields: []string{"noMatchingRule.action"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := newTestTokenetesConfigRule()
+			tt.rule(rule)
+
+			fields := fieldsOf(t, rule.Validate(), ErrInvalidTokenetesConfigRule)
+
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("Validate() fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestUpdateCompleteRules(t *testing.T) {
+	validRule := newTestRule("get-account", common.Get, "/accounts/{#id}")
+
+	invalidRule := newTestRule("bad-lifetime", common.Get, "/accounts")
+	invalidRule.LifeTime = "never"
+
+	invalidCurrentRule := newTestRule("current", common.Get, "/current/{#id}")
+	invalidCurrentRule.LifeTime = "never"
+
+	tests := []struct {
+		name              string
+		generationRules   *GenerationRules
+		wantRejectedRules []string
+		wantTraTNames     []string
+		wantRulesKept     bool
+		// wantCurrentRuleKept is set when the rule stored for "current" is the one from before the update.
+		wantCurrentRuleKept bool
+	}{
+		{
+			name: "valid rules",
+			generationRules: &GenerationRules{
+				TokenetesConfigGenerationRule: newTestTokenetesConfigRule(),
+				TraTsGenerationRules: map[string]*TraTGenerationRule{
+					"get-account":   validRule,
+					"list-accounts": newTestRule("list-accounts", common.Get, "/accounts"),
+				},
+			},
+			wantTraTNames: []string{"get-account", "list-accounts"},
+		},
+		{
+			name: "invalid and conflicting trat rules are dropped",
+			generationRules: &GenerationRules{
+				TokenetesConfigGenerationRule: newTestTokenetesConfigRule(),
+				TraTsGenerationRules: map[string]*TraTGenerationRule{
+					"get-account":   validRule,
+					"bad-lifetime":  invalidRule,
+					"other-account": newTestRule("other-account", common.Get, "/accounts/{#accountId}"),
+				},
+			},
+			wantRejectedRules: []string{"bad-lifetime", "other-account"},
+			wantTraTNames:     []string{"get-account"},
+		},
+		{
+			name: "rejected trat rule keeps the current rule of its trat",
+			generationRules: &GenerationRules{
+				TokenetesConfigGenerationRule: newTestTokenetesConfigRule(),
+				TraTsGenerationRules: map[string]*TraTGenerationRule{
+					"get-account": validRule,
+					"current":     invalidCurrentRule,
+				},
+			},
+			wantRejectedRules:   []string{"current"},
+			wantTraTNames:       []string{"current", "get-account"},
+			wantCurrentRuleKept: true,
+		},
+		{
+			name: "current rule conflicting with the accepted rules is not kept",
+			generationRules: &GenerationRules{
+				TokenetesConfigGenerationRule: newTestTokenetesConfigRule(),
+				TraTsGenerationRules: map[string]*TraTGenerationRule{
+					"current":       invalidCurrentRule,
+					"moved-current": newTestRule("moved-current", common.Get, "/current"),
+				},
+			},
+			wantRejectedRules: []string{"current"},
+			wantTraTNames:     []string{"moved-current"},
+		},
+		{
+			name: "invalid config rule rejects the update",
+			generationRules: &GenerationRules{
+				TokenetesConfigGenerationRule: &TokenetesConfigGenerationRule{},
+				TraTsGenerationRules: map[string]*TraTGenerationRule{
+					"list-accounts": newTestRule("list-accounts", common.Get, "/accounts"),
+				},
+			},
+			wantRejectedRules: []string{""},
+			wantRulesKept:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gri := NewGenerationRulesImp(nil, false)
+
+			if err := gri.UpsertTraTRule(*newTestRule("current", common.Get, "/current")); err != nil {
+				t.Fatalf("UpsertTraTRule() error = %v", err)
+			}
+
+			currentRule := gri.generationRules.TraTsGenerationRules["current"]
+
+			err := gri.UpdateCompleteRules(tt.generationRules)
+
+			var rejectedRules []string
+
+			if err != nil {
+				var validationErrors ValidationErrors
+				if !errors.As(err, &validationErrors) {
+					t.Fatalf("UpdateCompleteRules() error = %v, want ValidationErrors", err)
+				}
+
+				for _, validationError := range validationErrors {
+					rejectedRules = append(rejectedRules, validationError.Rule)
+				}
+
+				slices.Sort(rejectedRules)
+			}
+
+			if !reflect.DeepEqual(rejectedRules, tt.wantRejectedRules) {
+				t.Errorf("UpdateCompleteRules() rejected %v, want %v", rejectedRules, tt.wantRejectedRules)
+			}
+
+			wantTraTNames := tt.wantTraTNames
+			if tt.wantRulesKept {
+				wantTraTNames = []string{"current"}
+			}
+
+			var traTNames []string
+			for traTName := range gri.generationRules.TraTsGenerationRules {
+				traTNames = append(traTNames, traTName)
+			}
+
+			slices.Sort(traTNames)
+
+			if !reflect.DeepEqual(traTNames, wantTraTNames) {
+				t.Errorf("stored trat rules = %v, want %v", traTNames, wantTraTNames)
+			}
+
+			if tt.wantCurrentRuleKept && gri.generationRules.TraTsGenerationRules["current"] != currentRule {
+				t.Errorf("stored rule for current = %+v, want the rule from before the update", gri.generationRules.TraTsGenerationRules["current"])
+			}
+
+			for _, traTName := range wantTraTNames {
+				rule := gri.generationRules.TraTsGenerationRules[traTName]
+
+				if _, _, ok := gri.indexedTraTsGenerationRules[rule.Method].lookup(rule.Path, newRequestAttributes(common.RequestDetails{})); !ok {
+					t.Errorf("trat rule %s is not indexed", traTName)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const DEPENDENCY_CHECK_TIMEOUT = 3 * time.Second
+
+const (
+	STATUS_OK             = "ok"
+	STATUS_ERROR          = "error"
+	STATUS_NOT_CONFIGURED = "not_configured"
+)
+
+// ErrNotConfigured is returned by a dependency check when the dependency is not part of the current configuration.
+var ErrNotConfigured = errors.New("not configured")
+
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+type Status struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Ready        bool     `json:"ready"`
+	Checks       []Status `json:"checks"`
+	Dependencies []Status `json:"dependencies,omitempty"`
+}
+
+// Checker holds the readiness checks, which must all pass for the service to be ready, and the dependency checks,
+// which are only reported.
+type Checker struct {
+	readinessChecks  []namedCheck
+	dependencyChecks []namedCheck
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+func (c *Checker) AddReadinessCheck(name string, check Check) {
+	c.readinessChecks = append(c.readinessChecks, namedCheck{name: name, check: check})
+}
+
+func (c *Checker) AddDependencyCheck(name string, check Check) {
+	c.dependencyChecks = append(c.dependencyChecks, namedCheck{name: name, check: check})
+}
+
+func (c *Checker) CheckReadiness(ctx context.Context, includeDependencies bool) *Report {
+	report := &Report{
+		Ready:  true,
+		Checks: runChecks(ctx, c.readinessChecks),
+	}
+
+	for _, status := range report.Checks {
+		if status.Status != STATUS_OK {
+			report.Ready = false
+		}
+	}
+
+	if includeDependencies {
+		dependencyCtx, cancel := context.WithTimeout(ctx, DEPENDENCY_CHECK_TIMEOUT)
+		defer cancel()
+
+		report.Dependencies = runChecks(dependencyCtx, c.dependencyChecks)
+	}
+
+	return report
+}
+
+func runChecks(ctx context.Context, checks []namedCheck) []Status {
+	statuses := make([]Status, len(checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range checks {
+		wg.Add(1)
+
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+
+			statuses[i] = Status{Name: check.name, Status: STATUS_OK}
+
+			if err := check.check(ctx); err != nil {
+				if errors.Is(err, ErrNotConfigured) {
+					statuses[i].Status = STATUS_NOT_CONFIGURED
+				} else {
+					statuses[i].Status = STATUS_ERROR
+					statuses[i].Error = err.Error()
+				}
+			}
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	return statuses
+}
@@ -0,0 +1,226 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lestrrat-go/jwx/jwk"
+	"go.uber.org/zap"
+)
+
+const KEYS_DIR_RELOAD_DELAY = 1 * time.Second
+
+type fileKey struct {
+	privateKey crypto.PrivateKey
+	// algorithm is the alg declared by a JWK file, it is empty for PEM files.
+	algorithm string
+}
+
+var fileKeys []fileKey
+
+// update lock should be taken by the function calling reloadKeysFromDir. It loads every *.pem, *.json and *.jwk
+// private key in the keys directory; the keys are applied only if all of them parse.
+func reloadKeysFromDir() error {
+	entries, err := os.ReadDir(keysConfig.KeysDir)
+	if err != nil {
+		return fmt.Errorf("failed to read keys directory %s: %w", keysConfig.KeysDir, err)
+	}
+
+	fileNames := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		// Kubernetes mounts Secrets through hidden ..data directories.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".pem", ".json", ".jwk":
+			fileNames = append(fileNames, entry.Name())
+		}
+	}
+
+	sort.Strings(fileNames)
+
+	loadedKeys := make([]fileKey, 0, len(fileNames))
+
+	for _, fileName := range fileNames {
+		loadedKey, err := loadPrivateKeyFile(filepath.Join(keysConfig.KeysDir, fileName))
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", fileName, err)
+		}
+
+		loadedKeys = append(loadedKeys, loadedKey)
+	}
+
+	if err := activateFileKeys(loadedKeys); err != nil {
+		return err
+	}
+
+	fileKeys = loadedKeys
+
+	return nil
+}
+
+// update lock should be taken by the function calling activateFileKeys. The keys usable with the configured
+// algorithm are published, and the one whose file name sorts last becomes the signing key.
+func activateFileKeys(keys []fileKey) error {
+	usableKeys, err := usableFileKeys(keys, algorithm)
+	if err != nil {
+		return err
+	}
+
+	return replaceActiveKeys(usableKeys)
+}
+
+// usableFileKeys returns the signing keys for the file keys usable with the algorithm, in file name order.
+func usableFileKeys(keys []fileKey, algorithm string) ([]*signingKey, error) {
+	usableKeys := make([]*signingKey, 0, len(keys))
+	usableKids := make(map[string]bool, len(keys))
+
+	for _, key := range keys {
+		if key.algorithm != "" && key.algorithm != algorithm {
+			continue
+		}
+
+		if !isKeyUsableWith(key.privateKey, algorithm) {
+			continue
+		}
+
+		signingKey, err := newSigningKey(key.privateKey, algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		if usableKids[signingKey.kid] {
+			continue
+		}
+
+		usableKids[signingKey.kid] = true
+		usableKeys = append(usableKeys, signingKey)
+	}
+
+	if len(usableKeys) == 0 {
+		return nil, fmt.Errorf("no signing keys usable with %s found in %s", algorithm, keysConfig.KeysDir)
+	}
+
+	return usableKeys, nil
+}
+
+func loadPrivateKeyFile(path string) (fileKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileKey{}, err
+	}
+
+	if strings.ToLower(filepath.Ext(path)) == ".pem" {
+		privateKey, err := parsePEMPrivateKey(data)
+		if err != nil {
+			return fileKey{}, err
+		}
+
+		return fileKey{privateKey: privateKey}, nil
+	}
+
+	jwkKey, err := jwk.ParseKey(data)
+	if err != nil {
+		return fileKey{}, fmt.Errorf("failed to parse JWK: %w", err)
+	}
+
+	var privateKey interface{}
+	if err := jwkKey.Raw(&privateKey); err != nil {
+		return fileKey{}, fmt.Errorf("failed to get raw key from JWK: %w", err)
+	}
+
+	if _, ok := privateKey.(crypto.Signer); !ok {
+		return fileKey{}, errors.New("JWK is not a private key")
+	}
+
+	return fileKey{privateKey: privateKey, algorithm: jwkKey.Algorithm()}, nil
+}
+
+func parsePEMPrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse PEM private key: %w", err)
+		}
+
+		return privateKey, nil
+	}
+}
+
+func watchKeysDir(ctx context.Context, logger *zap.Logger) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("Failed to create keys directory watcher; signing keys will not be reloaded.", zap.Error(err))
+
+		return
+	}
+
+	defer watcher.Close()
+
+	if err := watcher.Add(keysConfig.KeysDir); err != nil {
+		logger.Error("Failed to watch keys directory; signing keys will not be reloaded.", zap.String("keys-dir", keysConfig.KeysDir), zap.Error(err))
+
+		return
+	}
+
+	// Updates to a directory usually arrive as a burst of events, reload once they have settled.
+	reloadTimer := time.NewTimer(KEYS_DIR_RELOAD_DELAY)
+	reloadTimer.Stop()
+
+	defer reloadTimer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			logger.Debug("Keys directory changed.", zap.String("event", event.String()))
+			reloadTimer.Reset(KEYS_DIR_RELOAD_DELAY)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+
+			logger.Error("Keys directory watcher error.", zap.Error(err))
+		case <-reloadTimer.C:
+			updateMu.Lock()
+			err := reloadKeysFromDir()
+			updateMu.Unlock()
+
+			if err != nil {
+				logger.Error("Failed to reload signing keys; keeping the current keys.", zap.Error(err))
+
+				continue
+			}
+
+			logger.Info("Reloaded signing keys from keys directory.", zap.String("kid", GetKid()))
+		}
+	}
+}
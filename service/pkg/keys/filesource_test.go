@@ -0,0 +1,381 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	formatPKCS1 = "pkcs1"
+	formatPKCS8 = "pkcs8"
+	formatEC    = "ec"
+	formatJWK   = "jwk"
+)
+
+type testKeyFile struct {
+	name   string
+	key    crypto.Signer
+	format string
+	// alg is the alg of a JWK file.
+	alg string
+}
+
+func writeKeyFile(t *testing.T, dir string, file testKeyFile) {
+	t.Helper()
+
+	var data []byte
+
+	var err error
+
+	switch file.format {
+	case formatPKCS1:
+		data = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(file.key.(*rsa.PrivateKey))})
+	case formatPKCS8:
+		var der []byte
+		if der, err = x509.MarshalPKCS8PrivateKey(file.key); err == nil {
+			data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		}
+	case formatEC:
+		var der []byte
+		if der, err = x509.MarshalECPrivateKey(file.key.(*ecdsa.PrivateKey)); err == nil {
+			data = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		}
+	case formatJWK:
+		var jwkKey jwk.Key
+		if jwkKey, err = jwk.New(file.key); err == nil {
+			if file.alg != "" {
+				jwkKey.Set(jwk.AlgorithmKey, file.alg)
+			}
+
+			data, err = json.Marshal(jwkKey)
+		}
+	default:
+		data = []byte("not a key")
+	}
+
+	if err != nil {
+		t.Fatalf("failed to encode %s: %v", file.name, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, file.name), data, 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", file.name, err)
+	}
+}
+
+// kidOf returns the kid a private key is published with for the algorithm.
+func kidOf(t *testing.T, privateKey crypto.Signer, algorithm string) string {
+	t.Helper()
+
+	key, err := newSigningKey(privateKey, algorithm)
+	if err != nil {
+		t.Fatalf("newSigningKey() error = %v", err)
+	}
+
+	return key.kid
+}
+
+func TestLoadKeysFromDir(t *testing.T) {
+	rsaKeys := make([]*rsa.PrivateKey, 3)
+	for i := range rsaKeys {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate RSA key: %v", err)
+		}
+
+		rsaKeys[i] = key
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	ecP384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		files     []testKeyFile
+		// hidden are entries written under a hidden directory or name, which are not loaded.
+		hidden []testKeyFile
+		// wantPublished are the keys published in the JWKS, the last of which signs.
+		wantPublished []crypto.Signer
+		wantErr       bool
+	}{
+		{
+			name:          "PKCS#1 RSA key",
+			algorithm:     RS256,
+			files:         []testKeyFile{{name: "a.pem", key: rsaKeys[0], format: formatPKCS1}},
+			wantPublished: []crypto.Signer{rsaKeys[0]},
+		},
+		{
+			name:          "PKCS#8 RSA key",
+			algorithm:     PS256,
+			files:         []testKeyFile{{name: "a.pem", key: rsaKeys[0], format: formatPKCS8}},
+			wantPublished: []crypto.Signer{rsaKeys[0]},
+		},
+		{
+			name:          "EC key",
+			algorithm:     ES256,
+			files:         []testKeyFile{{name: "a.pem", key: ecKey, format: formatEC}},
+			wantPublished: []crypto.Signer{ecKey},
+		},
+		{
+			name:          "PKCS#8 Ed25519 key",
+			algorithm:     EdDSA,
+			files:         []testKeyFile{{name: "a.pem", key: edKey, format: formatPKCS8}},
+			wantPublished: []crypto.Signer{edKey},
+		},
+		{
+			name:      "JWK files",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "a.json", key: rsaKeys[0], format: formatJWK, alg: RS256},
+				{name: "b.jwk", key: rsaKeys[1], format: formatJWK},
+			},
+			wantPublished: []crypto.Signer{rsaKeys[0], rsaKeys[1]},
+		},
+		{
+			name:      "hidden entries and other files are skipped",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "a.pem", key: rsaKeys[0], format: formatPKCS1},
+				{name: "README.txt"},
+			},
+			hidden: []testKeyFile{
+				{name: ".invalid.pem"},
+				{name: "..data/b.pem", key: rsaKeys[1], format: formatPKCS1},
+			},
+			wantPublished: []crypto.Signer{rsaKeys[0]},
+		},
+		{
+			name:      "keys that cannot be used with the algorithm are skipped",
+			algorithm: ES256,
+			files: []testKeyFile{
+				{name: "a.pem", key: ecKey, format: formatEC},
+				{name: "b.pem", key: rsaKeys[0], format: formatPKCS1},
+				{name: "c.pem", key: ecP384Key, format: formatEC},
+				{name: "d.jwk", key: ecKey, format: formatJWK, alg: "ES384"},
+				{name: "e.pem", key: edKey, format: formatPKCS8},
+			},
+			wantPublished: []crypto.Signer{ecKey},
+		},
+		{
+			name:      "JWK declaring another algorithm is skipped",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "a.pem", key: rsaKeys[0], format: formatPKCS1},
+				{name: "b.json", key: rsaKeys[1], format: formatJWK, alg: PS256},
+			},
+			wantPublished: []crypto.Signer{rsaKeys[0]},
+		},
+		{
+			name:      "key whose file name sorts last signs",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "2024-02.pem", key: rsaKeys[1], format: formatPKCS1},
+				{name: "2024-03.pem", key: rsaKeys[2], format: formatPKCS8},
+				{name: "2024-01.pem", key: rsaKeys[0], format: formatPKCS1},
+			},
+			wantPublished: []crypto.Signer{rsaKeys[0], rsaKeys[1], rsaKeys[2]},
+		},
+		{
+			name:      "same key in several files is published once",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "a.pem", key: rsaKeys[0], format: formatPKCS1},
+				{name: "b.json", key: rsaKeys[0], format: formatJWK},
+			},
+			wantPublished: []crypto.Signer{rsaKeys[0]},
+		},
+		{
+			name:      "no key usable with the algorithm",
+			algorithm: EdDSA,
+			files:     []testKeyFile{{name: "a.pem", key: rsaKeys[0], format: formatPKCS1}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid key file",
+			algorithm: RS256,
+			files: []testKeyFile{
+				{name: "a.pem", key: rsaKeys[0], format: formatPKCS1},
+				{name: "b.pem"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetKeys(t)
+
+			dir := t.TempDir()
+
+			for _, file := range tt.files {
+				writeKeyFile(t, dir, file)
+			}
+
+			for _, file := range tt.hidden {
+				if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file.name)), 0o700); err != nil {
+					t.Fatalf("failed to create directory: %v", err)
+				}
+
+				writeKeyFile(t, dir, file)
+			}
+
+			algorithm = tt.algorithm
+
+			err := Initialize(Config{KeysDir: dir})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Initialize() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			wantKids := make([]string, 0, len(tt.wantPublished))
+			for _, key := range tt.wantPublished {
+				wantKids = append(wantKids, kidOf(t, key, tt.algorithm))
+			}
+
+			if jwks := kidsOf(GetJWKS()); !slices.Equal(jwks, wantKids) {
+				t.Errorf("JWKS kids = %v, want %v", jwks, wantKids)
+			}
+
+			kid, signingAlgorithm, _ := GetSigningKey()
+			if kid != wantKids[len(wantKids)-1] || signingAlgorithm != tt.algorithm {
+				t.Errorf("GetSigningKey() = %s, %s, want %s, %s", kid, signingAlgorithm, wantKids[len(wantKids)-1], tt.algorithm)
+			}
+		})
+	}
+}
+
+func TestReloadKeysFromDir(t *testing.T) {
+	resetKeys(t)
+
+	rsaKeys := make([]*rsa.PrivateKey, 3)
+	for i := range rsaKeys {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate RSA key: %v", err)
+		}
+
+		rsaKeys[i] = key
+	}
+
+	kids := make([]string, len(rsaKeys))
+	for i, key := range rsaKeys {
+		kids[i] = kidOf(t, key, RS256)
+	}
+
+	dir := t.TempDir()
+
+	writeKeyFile(t, dir, testKeyFile{name: "a.pem", key: rsaKeys[0], format: formatPKCS1})
+	writeKeyFile(t, dir, testKeyFile{name: "b.pem", key: rsaKeys[1], format: formatPKCS1})
+
+	if err := Initialize(Config{KeysDir: dir}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	type step struct {
+		name        string
+		update      func()
+		wantErr     bool
+		wantSigning string
+		wantJWKS    []string
+		wantRetired []string
+	}
+
+	steps := []step{
+		{
+			name: "new key file signs",
+			update: func() {
+				writeKeyFile(t, dir, testKeyFile{name: "c.pem", key: rsaKeys[2], format: formatPKCS1})
+			},
+			wantSigning: kids[2],
+			wantJWKS:    []string{kids[0], kids[1], kids[2]},
+		},
+		{
+			name: "removed key files are retired",
+			update: func() {
+				os.Remove(filepath.Join(dir, "a.pem"))
+				os.Remove(filepath.Join(dir, "b.pem"))
+			},
+			wantSigning: kids[2],
+			wantJWKS:    []string{kids[2], kids[0], kids[1]},
+			wantRetired: []string{kids[0], kids[1]},
+		},
+		{
+			name: "invalid key file keeps the current keys",
+			update: func() {
+				writeKeyFile(t, dir, testKeyFile{name: "d.pem"})
+			},
+			wantErr:     true,
+			wantSigning: kids[2],
+			wantJWKS:    []string{kids[2], kids[0], kids[1]},
+			wantRetired: []string{kids[0], kids[1]},
+		},
+		{
+			name: "restored key file is active again",
+			update: func() {
+				os.Remove(filepath.Join(dir, "d.pem"))
+				writeKeyFile(t, dir, testKeyFile{name: "a.pem", key: rsaKeys[0], format: formatPKCS1})
+			},
+			wantSigning: kids[2],
+			wantJWKS:    []string{kids[0], kids[2], kids[1]},
+			wantRetired: []string{kids[1]},
+		},
+	}
+
+	for _, step := range steps {
+		step.update()
+
+		updateMu.Lock()
+		err := reloadKeysFromDir()
+		updateMu.Unlock()
+
+		if (err != nil) != step.wantErr {
+			t.Fatalf("%s: reloadKeysFromDir() error = %v, want error %v", step.name, err, step.wantErr)
+		}
+
+		if kid := GetKid(); kid != step.wantSigning {
+			t.Errorf("%s: signing kid = %s, want %s", step.name, kid, step.wantSigning)
+		}
+
+		if jwks := kidsOf(GetJWKS()); !slices.Equal(jwks, step.wantJWKS) {
+			t.Errorf("%s: JWKS kids = %v, want %v", step.name, jwks, step.wantJWKS)
+		}
+
+		retired := make([]string, 0, len(retiredKeys))
+		for _, key := range retiredKeys {
+			retired = append(retired, key.kid)
+		}
+
+		if len(retired) != len(step.wantRetired) || len(retired) > 0 && !slices.Equal(retired, step.wantRetired) {
+			t.Errorf("%s: retired kids = %v, want %v", step.name, retired, step.wantRetired)
+		}
+	}
+}
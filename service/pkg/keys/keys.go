@@ -1,73 +1,437 @@
 package keys
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/lestrrat-go/jwx/jwk"
+	"go.uber.org/zap"
 )
 
-var (
-	privateKey *rsa.PrivateKey
+const RETIRED_KEYS_PRUNE_INTERVAL = 1 * time.Minute
+
+const (
+	RS256 = "RS256"
+	PS256 = "PS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+
+	DEFAULT_SIGNING_ALGORITHM = RS256
+)
+
+var SupportedSigningAlgorithms = []string{RS256, PS256, ES256, EdDSA}
+
+type signingKey struct {
 	kid        string
-	keySet     jwk.Set
+	algorithm  string
+	privateKey crypto.PrivateKey
+	publicKey  jwk.Key
+	retiredAt  time.Time
+}
+
+type Config struct {
+	// KeysDir is an optional directory of PEM or JWK private key files, e.g. a mounted Kubernetes Secret.
+	// When it is empty an ephemeral key is generated and rotated every RotationInterval.
+	KeysDir          string
+	RotationInterval time.Duration
+	GracePeriod      time.Duration
+}
+
+var (
+	keysConfig      Config
+	algorithm       = DEFAULT_SIGNING_ALGORITHM
+	currentKey      *signingKey
+	activeKeys      []*signingKey
+	retiredKeys     []*signingKey
+	keySet          jwk.Set
+	jwksSubscribers []func(jwk.Set)
+	mu              sync.RWMutex
+	// updateMu serializes the operations that replace the active keys.
+	updateMu sync.Mutex
 )
 
-func Initialize() error {
-	return generateKeys()
+func Initialize(config Config) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	keysConfig = config
+
+	if keysConfig.KeysDir != "" {
+		return reloadKeysFromDir()
+	}
+
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return err
+	}
+
+	return replaceActiveKeys([]*signingKey{key})
+}
+
+// Start keeps the key set up to date until ctx is done: it rotates the ephemeral signing key every rotation
+// interval, or reloads the keys directory whenever it changes. A retired key stays in the JWKS for the configured
+// grace period, or for the maximum token lifetime if that is longer, so that tokens it signed remain verifiable
+// until they expire.
+func Start(ctx context.Context, maxTokenLifetime func() time.Duration, logger *zap.Logger) {
+	var rotation <-chan time.Time
+
+	if keysConfig.KeysDir != "" {
+		go watchKeysDir(ctx, logger)
+	} else if keysConfig.RotationInterval > 0 {
+		rotationTicker := time.NewTicker(keysConfig.RotationInterval)
+		defer rotationTicker.Stop()
+
+		rotation = rotationTicker.C
+	} else {
+		logger.Info("Signing key rotation is disabled.")
+	}
+
+	pruneTicker := time.NewTicker(RETIRED_KEYS_PRUNE_INTERVAL)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-rotation:
+			if err := Rotate(); err != nil {
+				logger.Error("Failed to rotate signing key.", zap.Error(err))
+
+				continue
+			}
+
+			logger.Info("Rotated signing key.", zap.String("kid", GetKid()))
+		case <-pruneTicker.C:
+			if err := pruneRetiredKeys(retiredKeyRetention(keysConfig.GracePeriod, maxTokenLifetime())); err != nil {
+				logger.Error("Failed to prune retired signing keys.", zap.Error(err))
+			}
+		}
+	}
+}
+
+func Rotate() error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	if keysConfig.KeysDir != "" {
+		return errors.New("signing keys loaded from a directory are rotated by updating the directory")
+	}
+
+	key, err := generateKey(algorithm)
+	if err != nil {
+		return err
+	}
+
+	return replaceActiveKeys([]*signingKey{key})
+}
+
+// CheckAlgorithm returns an error when the signing algorithm is unsupported or, with a keys directory, when no key
+// in the directory is usable with it.
+func CheckAlgorithm(newAlgorithm string) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	if !IsSupportedAlgorithm(newAlgorithm) {
+		return fmt.Errorf("unsupported signing algorithm: %s", newAlgorithm)
+	}
+
+	if keysConfig.KeysDir == "" {
+		return nil
+	}
+
+	_, err := usableFileKeys(fileKeys, newAlgorithm)
+
+	return err
+}
+
+// SetAlgorithm switches the signing algorithm. An ephemeral key of the new type is generated, or the keys directory
+// is searched for keys usable with it; the previous keys are retired.
+func SetAlgorithm(newAlgorithm string) error {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	if !IsSupportedAlgorithm(newAlgorithm) {
+		return fmt.Errorf("unsupported signing algorithm: %s", newAlgorithm)
+	}
+
+	if newAlgorithm == algorithm {
+		return nil
+	}
+
+	previousAlgorithm := algorithm
+	algorithm = newAlgorithm
+
+	var err error
+
+	if keysConfig.KeysDir != "" {
+		err = activateFileKeys(fileKeys)
+	} else {
+		var key *signingKey
+
+		key, err = generateKey(algorithm)
+		if err == nil {
+			err = replaceActiveKeys([]*signingKey{key})
+		}
+	}
+
+	if err != nil {
+		algorithm = previousAlgorithm
+
+		return err
+	}
+
+	return nil
+}
+
+func IsSupportedAlgorithm(algorithm string) bool {
+	for _, supportedAlgorithm := range SupportedSigningAlgorithms {
+		if algorithm == supportedAlgorithm {
+			return true
+		}
+	}
+
+	return false
+}
+
+// update lock should be taken by the function calling replaceActiveKeys. It makes the last of the given keys
+// the signing key and retires the previously active keys that are not part of the new set.
+func replaceActiveKeys(keys []*signingKey) error {
+	if len(keys) == 0 {
+		return errors.New("no signing keys available")
+	}
+
+	mu.Lock()
+
+	newKids := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		newKids[key.kid] = true
+	}
+
+	newRetiredKeys := make([]*signingKey, 0, len(retiredKeys)+len(activeKeys))
+
+	for _, key := range retiredKeys {
+		if !newKids[key.kid] {
+			newRetiredKeys = append(newRetiredKeys, key)
+		}
+	}
+
+	retiredAt := time.Now()
+
+	for _, key := range activeKeys {
+		if !newKids[key.kid] {
+			retiredKey := *key
+			retiredKey.retiredAt = retiredAt
+			newRetiredKeys = append(newRetiredKeys, &retiredKey)
+		}
+	}
+
+	// The new signing key is only used once it is published in the key set.
+	newKeySet, err := buildKeySet(keys, newRetiredKeys)
+	if err != nil {
+		mu.Unlock()
+
+		return err
+	}
+
+	currentKey = keys[len(keys)-1]
+	activeKeys = keys
+	retiredKeys = newRetiredKeys
+	keySet = newKeySet
+
+	mu.Unlock()
+
+	notifyJWKSSubscribers()
+
+	return nil
 }
 
-func generateKeys() error {
+// retiredKeyRetention returns how long a retired key stays in the JWKS: the grace period, or the maximum token
+// lifetime if that is longer.
+func retiredKeyRetention(gracePeriod time.Duration, maxTokenLifetime time.Duration) time.Duration {
+	return max(gracePeriod, maxTokenLifetime)
+}
+
+func pruneRetiredKeys(retention time.Duration) error {
+	mu.Lock()
+
+	activeRetiredKeys := make([]*signingKey, 0, len(retiredKeys))
+
+	for _, key := range retiredKeys {
+		if time.Since(key.retiredAt) < retention {
+			activeRetiredKeys = append(activeRetiredKeys, key)
+		}
+	}
+
+	if len(activeRetiredKeys) == len(retiredKeys) {
+		mu.Unlock()
+
+		return nil
+	}
+
+	newKeySet, err := buildKeySet(activeKeys, activeRetiredKeys)
+	if err != nil {
+		mu.Unlock()
+
+		return err
+	}
+
+	retiredKeys = activeRetiredKeys
+	keySet = newKeySet
+
+	mu.Unlock()
+
+	notifyJWKSSubscribers()
+
+	return nil
+}
+
+func generateKey(algorithm string) (*signingKey, error) {
+	var privateKey crypto.PrivateKey
+
 	var err error
 
-	privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	switch algorithm {
+	case RS256, PS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		privateKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+
 	if err != nil {
-		return fmt.Errorf("failed to generate RSA private key: %w", err)
+		return nil, fmt.Errorf("failed to generate %s private key: %w", algorithm, err)
 	}
 
-	publicKey := privateKey.PublicKey
+	return newSigningKey(privateKey, algorithm)
+}
+
+func isKeyUsableWith(privateKey crypto.PrivateKey, algorithm string) bool {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return algorithm == RS256 || algorithm == PS256
+	case *ecdsa.PrivateKey:
+		return algorithm == ES256 && key.Curve == elliptic.P256()
+	case ed25519.PrivateKey:
+		return algorithm == EdDSA
+	default:
+		return false
+	}
+}
 
-	jwkKey, err := jwk.New(&publicKey)
+func newSigningKey(privateKey crypto.PrivateKey, algorithm string) (*signingKey, error) {
+	if !isKeyUsableWith(privateKey, algorithm) {
+		return nil, fmt.Errorf("private key of type %T cannot be used with %s", privateKey, algorithm)
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key of type %T cannot sign", privateKey)
+	}
+
+	jwkKey, err := jwk.New(signer.Public())
 	if err != nil {
-		return fmt.Errorf("failed to create JWK from public key: %w", err)
+		return nil, fmt.Errorf("failed to create JWK from public key: %w", err)
 	}
 
-	if err := jwkKey.Set(jwk.AlgorithmKey, "RS256"); err != nil {
-		return fmt.Errorf("failed to set algorithm for JWK: %w", err)
+	if err := jwkKey.Set(jwk.AlgorithmKey, algorithm); err != nil {
+		return nil, fmt.Errorf("failed to set algorithm for JWK: %w", err)
 	}
 
 	if err := jwkKey.Set(jwk.KeyUsageKey, "sig"); err != nil {
-		return fmt.Errorf("failed to set usage for JWK: %w", err)
+		return nil, fmt.Errorf("failed to set usage for JWK: %w", err)
 	}
 
-	kidBytes := make([]byte, 16)
-	if _, err := rand.Read(kidBytes); err != nil {
-		return fmt.Errorf("failed to generate random bytes for Key ID: %w", err)
+	kid, err := thumbprintKid(jwkKey)
+	if err != nil {
+		return nil, err
 	}
 
-	kid = base64.StdEncoding.EncodeToString(kidBytes)
-
 	if err := jwkKey.Set(jwk.KeyIDKey, kid); err != nil {
-		return fmt.Errorf("failed to set Key ID for JWK: %w", err)
+		return nil, fmt.Errorf("failed to set Key ID for JWK: %w", err)
+	}
+
+	return &signingKey{
+		kid:        kid,
+		algorithm:  algorithm,
+		privateKey: privateKey,
+		publicKey:  jwkKey,
+	}, nil
+}
+
+// thumbprintKid returns the base64url encoded RFC 7638 SHA-256 thumbprint of the public key, which is the same for
+// every replica and restart using the key.
+func thumbprintKid(publicKey jwk.Key) (string, error) {
+	thumbprint, err := publicKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute JWK thumbprint: %w", err)
 	}
 
-	keySet = jwk.NewSet()
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
 
-	keySet.Add(jwkKey)
+// buildKeySet returns the JWKS publishing the given active and retired keys.
+func buildKeySet(activeKeys []*signingKey, retiredKeys []*signingKey) (jwk.Set, error) {
+	newKeySet := jwk.NewSet()
 
-	return nil
+	for _, key := range append(append([]*signingKey{}, activeKeys...), retiredKeys...) {
+		if !newKeySet.Add(key.publicKey) {
+			return nil, fmt.Errorf("duplicate key with kid %s in key set", key.kid)
+		}
+	}
+
+	return newKeySet, nil
 }
 
-func GetPrivateKey() *rsa.PrivateKey {
-	return privateKey
+// OnJWKSUpdate registers a function that is called with the new JWKS every time the key set changes.
+func OnJWKSUpdate(subscriber func(jwk.Set)) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	jwksSubscribers = append(jwksSubscribers, subscriber)
+}
+
+func notifyJWKSSubscribers() {
+	mu.RLock()
+	subscribers := jwksSubscribers
+	jwks := keySet
+	mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(jwks)
+	}
+}
+
+// GetSigningKey returns the kid, the algorithm and the private key used to sign new tokens.
+func GetSigningKey() (string, string, crypto.PrivateKey) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return currentKey.kid, currentKey.algorithm, currentKey.privateKey
 }
 
 func GetKid() string {
-	return kid
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return currentKey.kid
 }
 
 func GetJWKS() jwk.Set {
+	mu.RLock()
+	defer mu.RUnlock()
+
 	return keySet
 }
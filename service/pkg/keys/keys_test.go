@@ -0,0 +1,280 @@
+package keys
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+// resetKeys clears the package state before and after a test.
+func resetKeys(t *testing.T) {
+	t.Helper()
+
+	reset := func() {
+		keysConfig = Config{}
+		algorithm = DEFAULT_SIGNING_ALGORITHM
+		currentKey = nil
+		activeKeys = nil
+		retiredKeys = nil
+		keySet = nil
+		jwksSubscribers = nil
+		fileKeys = nil
+	}
+
+	reset()
+	t.Cleanup(reset)
+}
+
+// kidsOf returns the kids of a key set in order.
+func kidsOf(set jwk.Set) []string {
+	kids := make([]string, 0, set.Len())
+
+	for i := 0; i < set.Len(); i++ {
+		key, _ := set.Get(i)
+		kids = append(kids, key.KeyID())
+	}
+
+	return kids
+}
+
+func TestThumbprintKid(t *testing.T) {
+	// The example key and thumbprint of RFC 7638, section 3.1.
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatalf("failed to decode modulus: %v", err)
+	}
+
+	publicKey, err := jwk.New(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if err != nil {
+		t.Fatalf("failed to create JWK: %v", err)
+	}
+
+	// Members other than the required ones do not change the thumbprint.
+	publicKey.Set(jwk.AlgorithmKey, RS256)
+	publicKey.Set(jwk.KeyUsageKey, "sig")
+
+	kid, err := thumbprintKid(publicKey)
+	if err != nil {
+		t.Fatalf("thumbprintKid() error = %v", err)
+	}
+
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; kid != want {
+		t.Errorf("thumbprintKid() = %s, want %s", kid, want)
+	}
+}
+
+func TestSigningKeyKid(t *testing.T) {
+	for _, algorithm := range SupportedSigningAlgorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := generateKey(algorithm)
+			if err != nil {
+				t.Fatalf("generateKey() error = %v", err)
+			}
+
+			// The same private key gets the same kid, e.g. on another replica.
+			sameKey, err := newSigningKey(key.privateKey, algorithm)
+			if err != nil {
+				t.Fatalf("newSigningKey() error = %v", err)
+			}
+
+			if key.kid != sameKey.kid {
+				t.Errorf("kid = %s, then %s, want the same kid", key.kid, sameKey.kid)
+			}
+
+			wantKid, err := thumbprintKid(key.publicKey)
+			if err != nil {
+				t.Fatalf("thumbprintKid() error = %v", err)
+			}
+
+			if key.kid != wantKid || key.publicKey.KeyID() != wantKid {
+				t.Errorf("kid = %s, JWK kid = %s, want %s", key.kid, key.publicKey.KeyID(), wantKid)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	resetKeys(t)
+
+	if err := Initialize(Config{}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	firstKid := GetKid()
+
+	for rotation := 1; rotation <= 2; rotation++ {
+		previousKid := GetKid()
+
+		if err := Rotate(); err != nil {
+			t.Fatalf("Rotate() error = %v", err)
+		}
+
+		kid, _, _ := GetSigningKey()
+		if kid == previousKid {
+			t.Fatalf("rotation %d: signing kid = %s, want a new kid", rotation, kid)
+		}
+
+		if len(activeKeys) != 1 || activeKeys[0].kid != kid {
+			t.Errorf("rotation %d: active keys = %v, want only %s", rotation, activeKeys, kid)
+		}
+
+		if len(retiredKeys) != rotation || retiredKeys[rotation-1].kid != previousKid || retiredKeys[rotation-1].retiredAt.IsZero() {
+			t.Errorf("rotation %d: retired keys = %v, want %s retired last", rotation, retiredKeys, previousKid)
+		}
+
+		if retiredKeys[0].kid != firstKid {
+			t.Errorf("rotation %d: first retired kid = %s, want %s", rotation, retiredKeys[0].kid, firstKid)
+		}
+
+		// The new key signs, and the retired keys stay published to verify the tokens they signed.
+		wantKids := []string{kid}
+		for _, key := range retiredKeys {
+			wantKids = append(wantKids, key.kid)
+		}
+
+		if jwks := kidsOf(GetJWKS()); !slices.Equal(jwks, wantKids) {
+			t.Errorf("rotation %d: JWKS kids = %v, want %v", rotation, jwks, wantKids)
+		}
+	}
+}
+
+func TestRetiredKeyRetention(t *testing.T) {
+	tests := []struct {
+		name             string
+		gracePeriod      time.Duration
+		maxTokenLifetime time.Duration
+		want             time.Duration
+	}{
+		{name: "grace period longer than the token lifetime", gracePeriod: 10 * time.Minute, maxTokenLifetime: 5 * time.Minute, want: 10 * time.Minute},
+		{name: "token lifetime longer than the grace period", gracePeriod: time.Minute, maxTokenLifetime: time.Hour, want: time.Hour},
+		{name: "no grace period", maxTokenLifetime: 5 * time.Minute, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if retention := retiredKeyRetention(tt.gracePeriod, tt.maxTokenLifetime); retention != tt.want {
+				t.Errorf("retiredKeyRetention() = %v, want %v", retention, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneRetiredKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		// retiredFor is how long ago each retired key was retired.
+		retiredFor   []time.Duration
+		retention    time.Duration
+		wantRetained []int
+		wantNotified bool
+	}{
+		{
+			name:         "keys within the retention are kept",
+			retiredFor:   []time.Duration{time.Minute, 2 * time.Minute},
+			retention:    5 * time.Minute,
+			wantRetained: []int{0, 1},
+		},
+		{
+			name:         "keys past the retention are pruned",
+			retiredFor:   []time.Duration{10 * time.Minute, 2 * time.Minute},
+			retention:    5 * time.Minute,
+			wantRetained: []int{1},
+			wantNotified: true,
+		},
+		{
+			name:         "every retired key is pruned",
+			retiredFor:   []time.Duration{10 * time.Minute, 6 * time.Minute},
+			retention:    5 * time.Minute,
+			wantRetained: []int{},
+			wantNotified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetKeys(t)
+
+			if err := Initialize(Config{}); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+
+			for range tt.retiredFor {
+				if err := Rotate(); err != nil {
+					t.Fatalf("Rotate() error = %v", err)
+				}
+			}
+
+			retiredKids := make([]string, 0, len(retiredKeys))
+
+			for i, key := range retiredKeys {
+				key.retiredAt = time.Now().Add(-tt.retiredFor[i])
+				retiredKids = append(retiredKids, key.kid)
+			}
+
+			notified := false
+			OnJWKSUpdate(func(jwk.Set) { notified = true })
+
+			if err := pruneRetiredKeys(tt.retention); err != nil {
+				t.Fatalf("pruneRetiredKeys() error = %v", err)
+			}
+
+			wantKids := []string{GetKid()}
+			for _, i := range tt.wantRetained {
+				wantKids = append(wantKids, retiredKids[i])
+			}
+
+			if jwks := kidsOf(GetJWKS()); !slices.Equal(jwks, wantKids) {
+				t.Errorf("JWKS kids = %v, want %v", jwks, wantKids)
+			}
+
+			if notified != tt.wantNotified {
+				t.Errorf("subscribers notified = %v, want %v", notified, tt.wantNotified)
+			}
+		})
+	}
+}
+
+func TestJWKSSubscribers(t *testing.T) {
+	resetKeys(t)
+
+	if err := Initialize(Config{}); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	var updates []jwk.Set
+
+	OnJWKSUpdate(func(set jwk.Set) { updates = append(updates, set) })
+
+	previousKid := GetKid()
+
+	if err := Rotate(); err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+
+	if len(updates) != 1 {
+		t.Fatalf("updates after rotation = %d, want 1", len(updates))
+	}
+
+	if kids := kidsOf(updates[0]); len(kids) != 2 || kids[0] != GetKid() || kids[1] != previousKid {
+		t.Errorf("JWKS pushed on rotation = %v, want [%s %s]", kids, GetKid(), previousKid)
+	}
+
+	retiredKeys[0].retiredAt = time.Now().Add(-time.Hour)
+
+	if err := pruneRetiredKeys(time.Minute); err != nil {
+		t.Fatalf("pruneRetiredKeys() error = %v", err)
+	}
+
+	if len(updates) != 2 {
+		t.Fatalf("updates after pruning = %d, want 2", len(updates))
+	}
+
+	if kids := kidsOf(updates[1]); !slices.Equal(kids, []string{GetKid()}) {
+		t.Errorf("JWKS pushed on pruning = %v, want [%s]", kids, GetKid())
+	}
+}
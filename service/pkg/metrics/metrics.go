@@ -0,0 +1,171 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+)
+
+const NAMESPACE = "tokenetes"
+
+const (
+	OUTCOME_ISSUED = "issued"
+
+	// TRAT_NONE labels requests that failed before a trat generation rule was matched, and TRAT_FALLBACK requests
+	// issued a token by the no matching rule fallback.
+	TRAT_NONE     = "none"
+	TRAT_FALLBACK = "fallback"
+
+	STAGE_SUBJECT_VERIFICATION = "subject_verification"
+	STAGE_RULE_MATCH           = "rule_match"
+	STAGE_AZD_COMPUTATION      = "azd_computation"
+	STAGE_ACCESS_EVALUATION    = "access_evaluation"
+	STAGE_SIGNING              = "signing"
+
+	DECISION_PERMIT = "permit"
+	DECISION_DENY   = "deny"
+	DECISION_ERROR  = "error"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	txnTokenRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "txn_token_requests_total",
+		Help:      "Txn-Token requests by outcome, subject token type and trat. The trat of the matched rule stands in for the purp, which may be templated from the request and would make the label unbounded; it is none when no rule was matched and fallback for no matching rule fallback tokens.",
+	}, []string{"outcome", "subject_token_type", "trat"})
+
+	txnTokenGenerationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "txn_token_generation_duration_seconds",
+		Help:      "Time taken to process a Txn-Token request.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	txnTokenGenerationStageDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "txn_token_generation_stage_duration_seconds",
+		Help:      "Time taken by each stage of Txn-Token generation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"stage"})
+
+	accessEvaluationRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "access_evaluation_requests_total",
+		Help:      "Access evaluation API calls by decision.",
+	}, []string{"decision"})
+
+	accessEvaluationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "access_evaluation_request_duration_seconds",
+		Help:      "Latency of access evaluation API calls.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	accessEvaluationCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "access_evaluation_cache_lookups_total",
+		Help:      "Access evaluation decision cache lookups by result.",
+	}, []string{"result"})
+
+	configSyncConnected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_sync_connected",
+		Help:      "Whether the connection to tconfigd is established.",
+	})
+
+	configSyncReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_sync_reconnects_total",
+		Help:      "Reconnection attempts to tconfigd.",
+	})
+
+	configSyncLastRuleUpdate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_sync_last_rule_update_timestamp_seconds",
+		Help:      "Unix time of the last generation rules update.",
+	})
+
+	configSyncRuleHash = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "config_sync_rule_hash_info",
+		Help:      "Hash of the active generation rules.",
+	}, []string{"hash"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		txnTokenRequests,
+		txnTokenGenerationDuration,
+		txnTokenGenerationStageDuration,
+		accessEvaluationRequests,
+		accessEvaluationDuration,
+		accessEvaluationCacheLookups,
+		configSyncConnected,
+		configSyncReconnects,
+		configSyncLastRuleUpdate,
+		configSyncRuleHash,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveTxnTokenRequest records a processed Txn-Token request. Failed requests are counted by their error code.
+// Requests are labeled with the name of the trat of their rule rather than their purp, which may be templated
+// from the request.
+func ObserveTxnTokenRequest(subjectTokenType common.TokenType, traTName string, err error, duration time.Duration) {
+	outcome := OUTCOME_ISSUED
+
+	if err != nil {
+		errorCode, _ := tokeneteserrors.Classify(err)
+		outcome = string(errorCode)
+	}
+
+	txnTokenRequests.WithLabelValues(outcome, string(subjectTokenType), traTName).Inc()
+	txnTokenGenerationDuration.Observe(duration.Seconds())
+}
+
+func ObserveStage(stage string, start time.Time) {
+	txnTokenGenerationStageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+func ObserveAccessEvaluation(decision string, duration time.Duration) {
+	accessEvaluationRequests.WithLabelValues(decision).Inc()
+	accessEvaluationDuration.Observe(duration.Seconds())
+}
+
+func ObserveAccessEvaluationCache(hit bool) {
+	if hit {
+		accessEvaluationCacheLookups.WithLabelValues("hit").Inc()
+	} else {
+		accessEvaluationCacheLookups.WithLabelValues("miss").Inc()
+	}
+}
+
+func SetConfigSyncConnected(connected bool) {
+	if connected {
+		configSyncConnected.Set(1)
+	} else {
+		configSyncConnected.Set(0)
+	}
+}
+
+func IncConfigSyncReconnects() {
+	configSyncReconnects.Inc()
+}
+
+func SetRulesUpdated(ruleHash string) {
+	configSyncLastRuleUpdate.SetToCurrentTime()
+	configSyncRuleHash.Reset()
+	configSyncRuleHash.WithLabelValues(ruleHash).Set(1)
+}
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"context"
 	"crypto/x509"
 	"fmt"
 	"net/http"
@@ -9,6 +10,17 @@ import (
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 )
 
+type contextKey string
+
+const spiffeIDContextKey contextKey = "spiffe-id"
+
+// SpiffeIDFromContext returns the SPIFFE ID of the mTLS peer authorized by AuthorizeSpiffeID.
+func SpiffeIDFromContext(ctx context.Context) (string, bool) {
+	spiffeID, ok := ctx.Value(spiffeIDContextKey).(string)
+
+	return spiffeID, ok
+}
+
 func AuthorizeSpiffeID(authorizedIDs func() ([]spiffeid.ID, error)) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -39,7 +51,7 @@ func AuthorizeSpiffeID(authorizedIDs func() ([]spiffeid.ID, error)) func(http.Ha
 
 			for _, id := range authorizedIDStrings {
 				if spiffeID == id {
-					next.ServeHTTP(w, r)
+					next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), spiffeIDContextKey, spiffeID)))
 
 					return
 				}
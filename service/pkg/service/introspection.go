@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
+	"go.uber.org/zap"
+)
+
+// IntrospectionResponse is the RFC 7662 introspection response for a txn token. Only Active is set for tokens
+// that are not valid. ProjectedClaims holds the namespaced claims of projected subject token claims, keyed by the
+// name they have in the token, which depends on the rule the token was issued from.
+type IntrospectionResponse struct {
+	Active bool        `json:"active"`
+	Iss    interface{} `json:"iss,omitempty"`
+	Aud    interface{} `json:"aud,omitempty"`
+	Iat    interface{} `json:"iat,omitempty"`
+	Exp    interface{} `json:"exp,omitempty"`
+	Txn    interface{} `json:"txn,omitempty"`
+	Sub    interface{} `json:"sub,omitempty"`
+	Purp   interface{} `json:"purp,omitempty"`
+	Azd    interface{} `json:"azd,omitempty"`
+	Rctx   interface{} `json:"rctx,omitempty"`
+	Tctx   interface{} `json:"tctx,omitempty"`
+
+	ProjectedClaims map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON adds the projected claims to the response as top-level members, as they are in the token.
+func (r IntrospectionResponse) MarshalJSON() ([]byte, error) {
+	type introspectionResponse IntrospectionResponse
+
+	data, err := json.Marshal(introspectionResponse(r))
+	if err != nil || len(r.ProjectedClaims) == 0 {
+		return data, err
+	}
+
+	response := make(map[string]interface{}, len(r.ProjectedClaims))
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+
+	for name, claims := range r.ProjectedClaims {
+		response[name] = claims
+	}
+
+	return json.Marshal(response)
+}
+
+func (s *Service) IntrospectTxnToken(ctx context.Context, token string) *IntrospectionResponse {
+	claims, err := s.generationRules.GetTxnTokenHandler().VerifyAndParse(ctx, token)
+	if err != nil {
+		s.logger.Info("Introspected txn token is not active.", zap.Error(err))
+
+		return &IntrospectionResponse{Active: false}
+	}
+
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return &IntrospectionResponse{Active: false}
+	}
+
+	var projectedClaims map[string]interface{}
+
+	for name, claims := range mapClaims {
+		if !v1alpha1.IsReservedTxnTokenClaim(name) {
+			if projectedClaims == nil {
+				projectedClaims = make(map[string]interface{})
+			}
+
+			projectedClaims[name] = claims
+		}
+	}
+
+	return &IntrospectionResponse{
+		Active: true,
+		Iss:    mapClaims["iss"],
+		Aud:    mapClaims["aud"],
+		Iat:    mapClaims["iat"],
+		Exp:    mapClaims["exp"],
+		Txn:    mapClaims["txn"],
+		Sub:    mapClaims["sub"],
+		Purp:   mapClaims["purp"],
+		Azd:    mapClaims["azd"],
+		Rctx:   mapClaims["rctx"],
+		Tctx:   mapClaims[TRUSTED_CONTEXT_CLAIM],
+
+		ProjectedClaims: projectedClaims,
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
+	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/subjecttokenhandler"
+	"go.uber.org/zap"
+)
+
+func TestIntrospectTxnToken(t *testing.T) {
+	if err := keys.Initialize(keys.Config{}); err != nil {
+		t.Fatalf("keys.Initialize() error = %v", err)
+	}
+
+	subjectToken, err := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "alice", "tid": "tenant-1", "iss": "https://idp.example"}).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to create subject token: %v", err)
+	}
+
+	standardMembers := []string{"active", "aud", "azd", "exp", "iat", "iss", "purp", "rctx", "sub", "tctx", "txn"}
+
+	tests := []struct {
+		name                string
+		namespaceProjection *v1alpha1.ClaimsProjection
+		ruleProjection      *v1alpha1.ClaimsProjection
+		// wantProjectedClaims maps the name of the namespaced claim to the claims projected into it.
+		wantProjectedClaims map[string]interface{}
+	}{
+		{
+			name: "without projected claims",
+		},
+		{
+			name:                "namespace projection",
+			namespaceProjection: &v1alpha1.ClaimsProjection{Claims: map[string]string{"tenant": "tid"}},
+			wantProjectedClaims: map[string]interface{}{
+				v1alpha1.DEFAULT_PROJECTED_CLAIMS_NAME: map[string]interface{}{"tenant": "tenant-1"},
+			},
+		},
+		{
+			name:                "rule projection with its own name",
+			namespaceProjection: &v1alpha1.ClaimsProjection{Claims: map[string]string{"tenant": "tid"}},
+			ruleProjection:      &v1alpha1.ClaimsProjection{Name: "payments_ctx", Claims: map[string]string{"user": "sub"}},
+			wantProjectedClaims: map[string]interface{}{
+				"payments_ctx": map[string]interface{}{"tenant": "tenant-1", "user": "alice"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generationRules := v1alpha1.NewGenerationRulesImp(nil, false)
+
+			if err := generationRules.UpdateTokenetesConfigRule(v1alpha1.TokenetesConfigGenerationRule{
+				Token:            &v1alpha1.TokenetesConfigToken{Issuer: "https://tokenetes.example", Audience: "https://api.example", LifeTime: "5m"},
+				SubjectTokens:    &subjecttokenhandler.SubjectTokens{SelfSigned: &subjecttokenhandler.SelfSignedToken{}},
+				ClaimsProjection: tt.namespaceProjection,
+			}); err != nil {
+				t.Fatalf("UpdateTokenetesConfigRule() error = %v", err)
+			}
+
+			if err := generationRules.UpsertTraTRule(v1alpha1.TraTGenerationRule{
+				TraTName:         "list-accounts",
+				Path:             "/accounts",
+				Method:           common.Get,
+				Purp:             "list-accounts",
+				AzdMapping:       v1alpha1.AzdMapping{"tenant": {Value: "${subject_token.tid}"}},
+				ClaimsProjection: tt.ruleProjection,
+			}); err != nil {
+				t.Fatalf("UpsertTraTRule() error = %v", err)
+			}
+
+			service := NewService(generationRules, zap.NewNop())
+
+			tokenResponse, err := service.GenerateTxnToken(context.Background(), &common.TokenRequest{
+				Audience:         "https://api.example",
+				SubjectToken:     subjectToken,
+				SubjectTokenType: common.SELF_SIGNED_TOKEN_TYPE,
+				RequestDetails:   common.RequestDetails{Path: "/accounts", Method: common.Get},
+				RequestContext:   map[string]interface{}{"client": "web"},
+				Requester:        common.Requester{IP: "10.0.0.1"},
+			})
+			if err != nil {
+				t.Fatalf("GenerateTxnToken() error = %v", err)
+			}
+
+			data, err := json.Marshal(service.IntrospectTxnToken(context.Background(), tokenResponse.AccessToken))
+			if err != nil {
+				t.Fatalf("failed to marshal the introspection response: %v", err)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(data, &response); err != nil {
+				t.Fatalf("failed to unmarshal the introspection response: %v", err)
+			}
+
+			wantMembers := slices.Clone(standardMembers)
+			for name := range tt.wantProjectedClaims {
+				wantMembers = append(wantMembers, name)
+			}
+
+			slices.Sort(wantMembers)
+
+			members := make([]string, 0, len(response))
+			for member := range response {
+				members = append(members, member)
+			}
+
+			slices.Sort(members)
+
+			if !slices.Equal(members, wantMembers) {
+				t.Errorf("introspection response members = %v, want %v", members, wantMembers)
+			}
+
+			tctx, _ := response[TRUSTED_CONTEXT_CLAIM].(map[string]interface{})
+			if tctx["req_ip"] != "10.0.0.1" || tctx["authn"] == nil {
+				t.Errorf("introspection response tctx = %v, want the requester context", response[TRUSTED_CONTEXT_CLAIM])
+			}
+
+			for name, wantClaims := range tt.wantProjectedClaims {
+				if !reflect.DeepEqual(response[name], wantClaims) {
+					t.Errorf("introspection response %s = %v, want %v", name, response[name], wantClaims)
+				}
+			}
+		})
+	}
+}
+
+func TestIntrospectTxnTokenInactive(t *testing.T) {
+	if err := keys.Initialize(keys.Config{}); err != nil {
+		t.Fatalf("keys.Initialize() error = %v", err)
+	}
+
+	service := NewService(v1alpha1.NewGenerationRulesImp(nil, false), zap.NewNop())
+
+	data, err := json.Marshal(service.IntrospectTxnToken(context.Background(), "not-a-token"))
+	if err != nil {
+		t.Fatalf("failed to marshal the introspection response: %v", err)
+	}
+
+	if string(data) != `{"active":false}` {
+		t.Errorf("introspection response = %s, want {\"active\":false}", data)
+	}
+}
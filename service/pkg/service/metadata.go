@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+const (
+	TOKEN_EXCHANGE_GRANT_TYPE = "urn:ietf:params:oauth:grant-type:token-exchange"
+	TLS_CLIENT_AUTH_METHOD    = "tls_client_auth"
+)
+
+// AuthorizationServerMetadata is the RFC 8414 authorization server metadata of the txn-token service.
+type AuthorizationServerMetadata struct {
+	Issuer                            string             `json:"issuer"`
+	TokenEndpoint                     string             `json:"token_endpoint"`
+	IntrospectionEndpoint             string             `json:"introspection_endpoint"`
+	JWKSURI                           string             `json:"jwks_uri"`
+	GrantTypesSupported               []string           `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported []string           `json:"token_endpoint_auth_methods_supported"`
+	SubjectTokenTypesSupported        []common.TokenType `json:"subject_token_types_supported"`
+	IssuedTokenTypesSupported         []common.TokenType `json:"issued_token_types_supported"`
+	TxnTokenSigningAlgValuesSupported []string           `json:"txn_token_signing_alg_values_supported"`
+}
+
+// IssuerURL returns the token issuer, which RFC 8414 requires to be an https URL without query or fragment.
+func (s *Service) IssuerURL() (*url.URL, error) {
+	issuer := s.generationRules.GetIssuer()
+	if issuer == "" {
+		return nil, errors.New("token issuer is not configured yet")
+	}
+
+	issuerURL, err := url.Parse(issuer)
+	if err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" || issuerURL.RawQuery != "" || issuerURL.Fragment != "" {
+		return nil, fmt.Errorf("token issuer %q is not an https URL", issuer)
+	}
+
+	return issuerURL, nil
+}
+
+func (s *Service) GetAuthorizationServerMetadata(tokenEndpoint string, introspectionEndpoint string, jwksURI string) (*AuthorizationServerMetadata, error) {
+	issuerURL, err := s.IssuerURL()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthorizationServerMetadata{
+		Issuer:                            issuerURL.String(),
+		TokenEndpoint:                     tokenEndpoint,
+		IntrospectionEndpoint:             introspectionEndpoint,
+		JWKSURI:                           jwksURI,
+		GrantTypesSupported:               []string{TOKEN_EXCHANGE_GRANT_TYPE},
+		TokenEndpointAuthMethodsSupported: []string{TLS_CLIENT_AUTH_METHOD},
+		SubjectTokenTypesSupported:        s.generationRules.GetSupportedSubjectTokenTypes(),
+		IssuedTokenTypesSupported:         []common.TokenType{common.TXN_TOKEN_TYPE},
+		TxnTokenSigningAlgValuesSupported: []string{s.generationRules.GetSigningAlgorithm()},
+	}, nil
+}
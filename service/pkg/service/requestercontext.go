@@ -0,0 +1,83 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/tokenetes/tokenetes/pkg/common"
+)
+
+// TRUSTED_CONTEXT_CLAIM holds the requester context computed by tokenetes. Unlike rctx, which is copied from the
+// caller's request_context, every value in it has been verified by tokenetes.
+const TRUSTED_CONTEXT_CLAIM = "tctx"
+
+// requesterContext returns the trusted context of a txn token:
+//
+//   - req_wl: the SPIFFE ID of the workload that requested the token, from its mTLS certificate.
+//   - req_ip: the IP address the request was received from.
+//   - authn: the type and issuer of the subject token and the time the subject authenticated.
+//
+// A replacement txn token keeps the authn of the subject txn token, since the subject did not authenticate again.
+func requesterContext(txnTokenRequest *common.TokenRequest, subjectTokenClaims interface{}) map[string]interface{} {
+	trustedContext := make(map[string]interface{})
+
+	if txnTokenRequest.Requester.WorkloadID != "" {
+		trustedContext["req_wl"] = txnTokenRequest.Requester.WorkloadID
+	}
+
+	if txnTokenRequest.Requester.IP != "" {
+		trustedContext["req_ip"] = txnTokenRequest.Requester.IP
+	}
+
+	claims, ok := subjectTokenClaims.(jwt.MapClaims)
+	if !ok {
+		return trustedContext
+	}
+
+	if txnTokenRequest.SubjectTokenType == common.TXN_TOKEN_TYPE {
+		if parentContext, ok := claims[TRUSTED_CONTEXT_CLAIM].(map[string]interface{}); ok {
+			if authn, ok := parentContext["authn"]; ok {
+				trustedContext["authn"] = authn
+			}
+		}
+
+		return trustedContext
+	}
+
+	authn := map[string]interface{}{
+		"token_type": string(txnTokenRequest.SubjectTokenType),
+	}
+
+	if issuer, ok := claims["iss"].(string); ok && issuer != "" {
+		authn["iss"] = issuer
+	}
+
+	// auth_time is set by OIDC providers; other subject tokens were authenticated when they were issued.
+	if authTime, ok := numericDateClaim(claims, "auth_time"); ok {
+		authn["auth_time"] = authTime.Unix()
+	} else if issuedAt, ok := numericDateClaim(claims, "iat"); ok {
+		authn["auth_time"] = issuedAt.Unix()
+	}
+
+	trustedContext["authn"] = authn
+
+	return trustedContext
+}
+
+// numericDateClaim returns a NumericDate claim, which is a float64 or, with UseNumber decoding, a json.Number.
+func numericDateClaim(claims jwt.MapClaims, name string) (time.Time, bool) {
+	switch value := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(value), 0), true
+	case json.Number:
+		seconds, err := value.Int64()
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		return time.Unix(seconds, 0), true
+	default:
+		return time.Time{}, false
+	}
+}
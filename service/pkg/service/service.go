@@ -2,7 +2,12 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -11,7 +16,11 @@ import (
 	"github.com/tokenetes/tokenetes/pkg/common"
 	"github.com/tokenetes/tokenetes/pkg/generationrules/v1alpha1"
 	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/metrics"
 	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -41,7 +50,46 @@ func (s *Service) GetJwks() jwk.Set {
 	return keys.GetJWKS()
 }
 
-func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.TokenRequest) (*TokenResponse, error) {
+func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.TokenRequest) (tokenResponse *TokenResponse, err error) {
+	var purp string
+
+	traTName := metrics.TRAT_NONE
+
+	ctx, span := tracing.StartSpan(ctx, "Service.GenerateTxnToken", trace.WithAttributes(
+		attribute.String("tokenetes.subject_token_type", string(txnTokenRequest.SubjectTokenType)),
+		attribute.String("tokenetes.request.path", txnTokenRequest.RequestDetails.Path),
+		attribute.String("tokenetes.request.method", string(txnTokenRequest.RequestDetails.Method)),
+	))
+
+	defer func(start time.Time) {
+		span.SetAttributes(attribute.String("tokenetes.purp", purp))
+		tracing.EndSpan(span, err)
+		metrics.ObserveTxnTokenRequest(txnTokenRequest.SubjectTokenType, traTName, err, time.Since(start))
+	}(time.Now())
+
+	// The request is matched once, so that every step issues the token from the same rule and configuration.
+	matchedRequest, err := s.generationRules.MatchRequest(txnTokenRequest)
+	if err != nil {
+		s.logger.Error("Failed to match the request to a trat generation rule.", zap.Error(err))
+
+		return &TokenResponse{}, err
+	}
+
+	traTName = matchedRequest.TraTName()
+	if traTName == "" {
+		traTName = metrics.TRAT_FALLBACK
+	}
+
+	tokenSettings := matchedRequest.TokenSettings()
+
+	if txnTokenRequest.Audience != tokenSettings.Audience {
+		s.logger.Error("Requested audience is not supported.", zap.String("audience", txnTokenRequest.Audience))
+
+		return &TokenResponse{}, fmt.Errorf("%w: %s", tokeneteserrors.ErrInvalidAudience, txnTokenRequest.Audience)
+	}
+
+	subjectVerificationStart := time.Now()
+
 	subjectTokenHandler, err := s.generationRules.GetSubjectTokenHandler(txnTokenRequest.SubjectTokenType)
 	if err != nil {
 		s.logger.Error("Failed to get subject token handler.", zap.String("subject-token-type", string(txnTokenRequest.SubjectTokenType)), zap.Error(err))
@@ -50,6 +98,9 @@ func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.
 	}
 
 	subjectTokenClaims, err := subjectTokenHandler.VerifyAndParse(ctx, txnTokenRequest.SubjectToken)
+
+	metrics.ObserveStage(metrics.STAGE_SUBJECT_VERIFICATION, subjectVerificationStart)
+
 	if err != nil {
 		s.logger.Error("Failed to verify and parse subject token.", zap.Error(err))
 
@@ -65,14 +116,26 @@ func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.
 
 	s.logger.Info("Successfully verified subject token.", zap.Any("subject", subject))
 
-	purp, adz, err := s.generationRules.ConstructPurpAndAzd(txnTokenRequest)
+	purp, adz, err := matchedRequest.ConstructPurpAndAzd()
 	if err != nil {
 		s.logger.Error("Failed to generate scope and authorization details for a request.", zap.Error(err))
 
 		return &TokenResponse{}, err
 	}
 
-	accessEvaluation, err := s.generationRules.EvaluateAccess(txnTokenRequest, subjectTokenClaims)
+	projectedClaimsName, projectedClaims, err := matchedRequest.ProjectSubjectClaims(subjectTokenClaims)
+	if err != nil {
+		s.logger.Error("Failed to project subject token claims.", zap.Error(err))
+
+		return &TokenResponse{}, err
+	}
+
+	accessEvaluationStart := time.Now()
+
+	accessEvaluation, err := matchedRequest.EvaluateAccess(ctx, subjectTokenClaims, purp)
+
+	metrics.ObserveStage(metrics.STAGE_ACCESS_EVALUATION, accessEvaluationStart)
+
 	if err != nil {
 		s.logger.Error("Error evaluating access.", zap.Error(err))
 
@@ -90,45 +153,104 @@ func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.
 
 	s.logger.Info("Access authorized for request.", zap.Any("subject", subject), zap.String("purp", purp))
 
-	txnID, err := uuid.NewRandom()
-	if err != nil {
-		s.logger.Error("Error generating transaction id.")
+	var txnID, parentTokenHash string
 
-		return &TokenResponse{}, err
+	if txnTokenRequest.SubjectTokenType == common.TXN_TOKEN_TYPE {
+		parentClaims, ok := subjectTokenClaims.(jwt.MapClaims)
+		if !ok {
+			return &TokenResponse{}, tokeneteserrors.ErrInvalidSubjectTokenClaims
+		}
+
+		if err := verifyReplacementNarrowing(parentClaims, purp, adz); err != nil {
+			s.logger.Error("Replacement txn token request expands the subject txn token.", zap.Any("subject", subject), zap.String("purp", purp), zap.Error(err))
+
+			return &TokenResponse{}, fmt.Errorf("%w: %v", tokeneteserrors.ErrReplacementScopeExpansion, err)
+		}
+
+		txnID, _ = parentClaims["txn"].(string)
+		parentTokenHash = hashToken(txnTokenRequest.SubjectToken)
+
+		s.logger.Info("Issuing replacement txn token.", zap.String("txn", txnID))
+	} else {
+		newTxnID, err := uuid.NewRandom()
+		if err != nil {
+			s.logger.Error("Error generating transaction id.")
+
+			return &TokenResponse{}, err
+		}
+
+		txnID = newTxnID.String()
 	}
 
-	tokenLifetime, err := s.generationRules.GetTokenLifetime()
-	if err != nil {
-		s.logger.Error("Error generating token lifetime.", zap.Error(err))
+	now := time.Now()
 
-		return &TokenResponse{}, err
+	expiry := now.Add(tokenSettings.LifeTime)
+
+	// A txn token must not outlive the subject token it was issued for.
+	if subjectTokenExpiry, ok := subjectTokenExpiry(subjectTokenClaims); ok && subjectTokenExpiry.Before(expiry) {
+		expiry = subjectTokenExpiry
+	}
+
+	if !expiry.After(now) {
+		s.logger.Error("Subject token expires before a txn token can be issued.", zap.Any("subject", subject))
+
+		return &TokenResponse{}, fmt.Errorf("%w: subject token is expired", tokeneteserrors.ErrInvalidSubjectToken)
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                 tokenSettings.Issuer,
+		"iat":                 now.Unix(),
+		"aud":                 tokenSettings.Audience,
+		"exp":                 expiry.Unix(),
+		"txn":                 txnID,
+		"sub":                 subject,
+		"purp":                purp,
+		"azd":                 adz,
+		"rctx":                txnTokenRequest.RequestContext,
+		TRUSTED_CONTEXT_CLAIM: requesterContext(txnTokenRequest, subjectTokenClaims),
+	}
+
+	if parentTokenHash != "" {
+		claims["parent"] = parentTokenHash
+	}
+
+	if projectedClaims != nil {
+		claims[projectedClaimsName] = projectedClaims
+	}
+
+	// The trace id is only signed into the token when this service traces the request; otherwise it would be
+	// taken as is from the caller's traceparent header.
+	if traceID := tracing.RecordingTraceID(ctx); traceID != "" {
+		claims["trace_id"] = traceID
 	}
 
-	newToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"iss":  s.generationRules.GetIssuer(),
-		"iat":  time.Now().Unix(),
-		"aud":  s.generationRules.GetAudience(),
-		"exp":  time.Now().Add(tokenLifetime).Unix(),
-		"txn":  txnID,
-		"sub":  subject,
-		"purp": purp,
-		"azd":  adz,
-		"rctx": txnTokenRequest.RequestContext,
-	})
+	kid, signingAlgorithm, privateKey := keys.GetSigningKey()
+
+	signingMethod := jwt.GetSigningMethod(signingAlgorithm)
+	if signingMethod == nil {
+		s.logger.Error("Unsupported signing algorithm.", zap.String("algorithm", signingAlgorithm))
+
+		return &TokenResponse{}, fmt.Errorf("unsupported signing algorithm: %s", signingAlgorithm)
+	}
+
+	newToken := jwt.NewWithClaims(signingMethod, claims)
 
 	newToken.Header["typ"] = TOKEN_JWT_HEADER
-	newToken.Header["kid"] = keys.GetKid()
+	newToken.Header["kid"] = kid
 
-	privateKey := keys.GetPrivateKey()
+	signingStart := time.Now()
 
 	tokenString, err := newToken.SignedString(privateKey)
+
+	metrics.ObserveStage(metrics.STAGE_SIGNING, signingStart)
+
 	if err != nil {
 		s.logger.Error("Failed to sign txn token.", zap.Error(err))
 
 		return &TokenResponse{}, err
 	}
 
-	tokenResponse := &TokenResponse{
+	tokenResponse = &TokenResponse{
 		TokenType:       "N_A",
 		IssuedTokenType: common.TXN_TOKEN_TYPE,
 		AccessToken:     tokenString,
@@ -140,3 +262,57 @@ func (s *Service) GenerateTxnToken(ctx context.Context, txnTokenRequest *common.
 func (s *Service) GetGenerationRules() (json.RawMessage, error) {
 	return s.generationRules.GetRulesJSON()
 }
+
+// A replacement txn token may keep or drop the parent's azd fields and may only refine the parent purp
+// into a dot-separated sub-purpose, e.g. "orders" into "orders.read".
+func verifyReplacementNarrowing(parentClaims jwt.MapClaims, purp string, azd map[string]interface{}) error {
+	parentPurp, _ := parentClaims["purp"].(string)
+	if purp != parentPurp && !strings.HasPrefix(purp, parentPurp+".") {
+		return fmt.Errorf("purp %q is not a narrowing of the subject txn token purp %q", purp, parentPurp)
+	}
+
+	parentAzd, _ := parentClaims["azd"].(map[string]interface{})
+
+	for key, value := range azd {
+		parentValue, ok := parentAzd[key]
+		if !ok {
+			return fmt.Errorf("azd field %s is not present in the subject txn token", key)
+		}
+
+		if !reflect.DeepEqual(normalizeJSON(value), normalizeJSON(parentValue)) {
+			return fmt.Errorf("azd field %s differs from the subject txn token", key)
+		}
+	}
+
+	return nil
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+
+	return normalized
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// subjectTokenExpiry returns the exp claim of the subject token, if it has one.
+func subjectTokenExpiry(subjectTokenClaims interface{}) (time.Time, bool) {
+	claims, ok := subjectTokenClaims.(jwt.MapClaims)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return numericDateClaim(claims, "exp")
+}
@@ -3,19 +3,25 @@ package subjecttokenhandler
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/coreos/go-oidc"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/tokenetes/tokenetes/pkg/subjectidentifier"
 	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
 	"go.uber.org/zap"
 )
 
 const OIDC_PROVIDER_INITILIZATION_MAX_RETRIES = 5
 
+var oidcHTTPClient = tracing.NewHTTPClient()
+
 type OIDCTokenHandler struct {
 	subjectField string
+	providerURL  string
 	verifier     *oidc.IDTokenVerifier
 }
 
@@ -27,16 +33,43 @@ func NewOIDCTokenHandler(oidcConfig *OIDCToken, logger *zap.Logger) *OIDCTokenHa
 	})
 
 	return &OIDCTokenHandler{subjectField: oidcConfig.SubjectField,
-		verifier: verifier}
+		providerURL: oidcConfig.ProviderURL,
+		verifier:    verifier}
+}
+
+// CheckProvider checks that the OIDC provider's discovery document is reachable.
+func (o *OIDCTokenHandler) CheckProvider(ctx context.Context) error {
+	discoveryURL := strings.TrimSuffix(o.providerURL, "/") + "/.well-known/openid-configuration"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OIDC discovery returned status %d", resp.StatusCode)
+	}
+
+	return nil
 }
 
-func (o *OIDCTokenHandler) VerifyAndParse(ctx context.Context, token string) (interface{}, error) {
+func (o *OIDCTokenHandler) VerifyAndParse(ctx context.Context, token string) (_ interface{}, err error) {
+	ctx, span := tracing.StartSpan(ctx, "OIDCTokenHandler.VerifyAndParse")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	idToken, err := o.verifier.Verify(ctx, token)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", tokeneteserrors.ErrInvalidSubjectToken, err)
 	}
 
 	var claims jwt.MapClaims
@@ -66,7 +99,8 @@ func getOIDCProvider(oidcIssuer string, logger *zap.Logger) *oidc.Provider {
 	delay := time.Second
 
 	for i := 0; i < OIDC_PROVIDER_INITILIZATION_MAX_RETRIES; i++ {
-		ctx := context.Background()
+		// The provider keeps this context to fetch the discovery document and the JWKS.
+		ctx := oidc.ClientContext(context.Background(), oidcHTTPClient)
 
 		provider, err := oidc.NewProvider(ctx, oidcIssuer)
 		if err == nil {
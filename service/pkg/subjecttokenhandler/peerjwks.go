@@ -0,0 +1,75 @@
+package subjecttokenhandler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+const (
+	// PEER_JWKS_REFRESH_INTERVAL is how long a peer JWKS is used before it is fetched again.
+	PEER_JWKS_REFRESH_INTERVAL = 5 * time.Minute
+	// PEER_JWKS_MIN_REFRESH_INTERVAL is the minimum time between two fetches of a peer JWKS. Txn tokens with unknown
+	// kids refresh the key set early, since a peer may have rotated its key, but cannot make every request fetch it.
+	PEER_JWKS_MIN_REFRESH_INTERVAL = 10 * time.Second
+)
+
+// peerJWKS caches the JWKS of a peer instance.
+type peerJWKS struct {
+	endpoint string
+	fetch    func(ctx context.Context, jwksEndpointURL string) (jwk.Set, error)
+	now      func() time.Time
+
+	mu          sync.Mutex
+	set         jwk.Set
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func newPeerJWKS(endpoint string) *peerJWKS {
+	return &peerJWKS{
+		endpoint: endpoint,
+		fetch:    fetchJWKS,
+		now:      time.Now,
+	}
+}
+
+// lookupKey returns the key of the peer with the kid. The key set is fetched when it is missing or older than
+// PEER_JWKS_REFRESH_INTERVAL, or when it does not hold the kid, at most once per PEER_JWKS_MIN_REFRESH_INTERVAL. A
+// key set that cannot be refreshed keeps being used. The error reports a failed fetch.
+func (p *peerJWKS) lookupKey(ctx context.Context, kid string) (jwk.Key, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+
+	if p.set != nil && now.Sub(p.fetchedAt) < PEER_JWKS_REFRESH_INTERVAL {
+		if key, ok := p.set.LookupKeyID(kid); ok {
+			return key, true, nil
+		}
+	}
+
+	var fetchErr error
+
+	if p.attemptedAt.IsZero() || now.Sub(p.attemptedAt) >= PEER_JWKS_MIN_REFRESH_INTERVAL {
+		p.attemptedAt = now
+
+		set, err := p.fetch(ctx, p.endpoint)
+		if err != nil {
+			fetchErr = err
+		} else {
+			p.set = set
+			p.fetchedAt = now
+		}
+	}
+
+	if p.set == nil {
+		return nil, false, fetchErr
+	}
+
+	key, ok := p.set.LookupKeyID(kid)
+
+	return key, ok, fetchErr
+}
@@ -0,0 +1,109 @@
+package subjecttokenhandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/jwk"
+)
+
+func TestPeerJWKSLookupKey(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	oldSet := newTestKeySet(t, &privateKey.PublicKey, "old-kid")
+	newSet := newTestKeySet(t, &privateKey.PublicKey, "new-kid")
+
+	type lookup struct {
+		// after is the time since the first lookup.
+		after     time.Duration
+		kid       string
+		wantFound bool
+		// wantFetches is the number of fetches after the lookup.
+		wantFetches int
+	}
+
+	tests := []struct {
+		name    string
+		sets    []jwk.Set
+		fail    bool
+		lookups []lookup
+	}{
+		{
+			name: "cached key set is reused",
+			sets: []jwk.Set{oldSet},
+			lookups: []lookup{
+				{after: 0, kid: "old-kid", wantFound: true, wantFetches: 1},
+				{after: time.Minute, kid: "old-kid", wantFound: true, wantFetches: 1},
+			},
+		},
+		{
+			name: "key set is refreshed after the refresh interval",
+			sets: []jwk.Set{oldSet, newSet},
+			lookups: []lookup{
+				{after: 0, kid: "old-kid", wantFound: true, wantFetches: 1},
+				{after: PEER_JWKS_REFRESH_INTERVAL, kid: "new-kid", wantFound: true, wantFetches: 2},
+				{after: PEER_JWKS_REFRESH_INTERVAL, kid: "old-kid", wantFound: false, wantFetches: 2},
+			},
+		},
+		{
+			name: "unknown kids refresh the key set at most once per minimum refresh interval",
+			sets: []jwk.Set{oldSet, newSet},
+			lookups: []lookup{
+				{after: 0, kid: "new-kid", wantFound: false, wantFetches: 1},
+				{after: time.Second, kid: "new-kid", wantFound: false, wantFetches: 1},
+				{after: PEER_JWKS_MIN_REFRESH_INTERVAL, kid: "new-kid", wantFound: true, wantFetches: 2},
+				{after: PEER_JWKS_MIN_REFRESH_INTERVAL + time.Second, kid: "unknown-kid", wantFound: false, wantFetches: 2},
+			},
+		},
+		{
+			name: "failed fetches are rate limited",
+			fail: true,
+			lookups: []lookup{
+				{after: 0, kid: "old-kid", wantFound: false, wantFetches: 1},
+				{after: time.Second, kid: "old-kid", wantFound: false, wantFetches: 1},
+				{after: PEER_JWKS_MIN_REFRESH_INTERVAL, kid: "old-kid", wantFound: false, wantFetches: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			now := start
+			fetches := 0
+
+			peerJWKS := newPeerJWKS("https://peer.example/.well-known/jwks.json")
+			peerJWKS.now = func() time.Time { return now }
+			peerJWKS.fetch = func(context.Context, string) (jwk.Set, error) {
+				fetches++
+
+				if tt.fail {
+					return nil, errors.New("peer unavailable")
+				}
+
+				return tt.sets[min(fetches, len(tt.sets))-1], nil
+			}
+
+			for i, lookup := range tt.lookups {
+				now = start.Add(lookup.after)
+
+				_, found, _ := peerJWKS.lookupKey(context.Background(), lookup.kid)
+
+				if found != lookup.wantFound {
+					t.Errorf("lookup %d: found = %v, want %v", i, found, lookup.wantFound)
+				}
+
+				if fetches != lookup.wantFetches {
+					t.Errorf("lookup %d: fetches = %d, want %d", i, fetches, lookup.wantFetches)
+				}
+			}
+		})
+	}
+}
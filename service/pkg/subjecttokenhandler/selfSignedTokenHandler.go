@@ -9,6 +9,9 @@ import (
 	"github.com/lestrrat-go/jwx/jwk"
 	"github.com/tokenetes/tokenetes/pkg/subjectidentifier"
 	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"github.com/tokenetes/tokenetes/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -30,7 +33,7 @@ func NewSelfSignedTokenHandler(selfSignedConfig *SelfSignedToken, logger *zap.Lo
 
 func (s *SelfSignedTokenHandler) VerifyAndParse(ctx context.Context, token string) (interface{}, error) {
 	if s.validate {
-		jwks, err := fetchJWKS(s.jwksEndpoint)
+		jwks, err := fetchJWKS(ctx, s.jwksEndpoint)
 		if err != nil {
 			return nil, err
 		}
@@ -55,7 +58,7 @@ func (s *SelfSignedTokenHandler) VerifyAndParse(ctx context.Context, token strin
 
 		parsedToken, err := jwt.Parse(token, keyFunc)
 		if err != nil {
-			return nil, fmt.Errorf("error verifying token: %v", err)
+			return nil, fmt.Errorf("%w: error verifying token: %v", tokeneteserrors.ErrInvalidSubjectToken, err)
 		}
 
 		if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok {
@@ -68,7 +71,7 @@ func (s *SelfSignedTokenHandler) VerifyAndParse(ctx context.Context, token strin
 
 		parsedToken, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
 		if err != nil {
-			return nil, fmt.Errorf("error parsing token: %v", err)
+			return nil, fmt.Errorf("%w: %v", tokeneteserrors.ErrParsingSubjectToken, err)
 		}
 
 		if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok {
@@ -93,14 +96,14 @@ func (o *SelfSignedTokenHandler) ExtractSubject(claims interface{}) (subjectiden
 	return subValue, nil
 }
 
-func fetchJWKS(jwksEndpointURL string) (jwk.Set, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+var jwksHTTPClient = tracing.NewHTTPClient()
 
-	set, err := jwk.Fetch(ctx, jwksEndpointURL)
-	if err != nil {
-		return nil, err
-	}
+func fetchJWKS(ctx context.Context, jwksEndpointURL string) (set jwk.Set, err error) {
+	ctx, span := tracing.StartSpan(ctx, "fetchJWKS", trace.WithAttributes(attribute.String("tokenetes.jwks_endpoint", jwksEndpointURL)))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	return set, nil
+	return jwk.Fetch(ctx, jwksEndpointURL, jwk.WithHTTPClient(jwksHTTPClient))
 }
@@ -2,17 +2,19 @@ package subjecttokenhandler
 
 import (
 	"context"
-	"errors"
 	"fmt"
 
 	"github.com/tokenetes/tokenetes/pkg/common"
+	"github.com/tokenetes/tokenetes/pkg/health"
 	"github.com/tokenetes/tokenetes/pkg/subjectidentifier"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
 	"go.uber.org/zap"
 )
 
 type SubjectTokens struct {
 	OIDC       *OIDCToken       `json:"OIDC,omitempty"`
 	SelfSigned *SelfSignedToken `json:"selfSigned,omitempty"`
+	TxnToken   *TxnToken        `json:"txnToken,omitempty"`
 }
 
 type OIDCToken struct {
@@ -26,6 +28,10 @@ type SelfSignedToken struct {
 	JWKSSEndpoint string `json:"jwksEndpoint"`
 }
 
+type TxnToken struct {
+	PeerJWKSEndpoints []string `json:"peerJwksEndpoints"`
+}
+
 type TokenHandler interface {
 	VerifyAndParse(ctx context.Context, token string) (interface{}, error)
 	ExtractSubject(claims interface{}) (subjectidentifier.Identifier, error)
@@ -34,9 +40,10 @@ type TokenHandler interface {
 type TokenHandlers struct {
 	oIDCTokenHandler       TokenHandler
 	selfSignedTokenHandler TokenHandler
+	txnTokenHandler        TokenHandler
 }
 
-func NewTokenHandlers(subjectTokens SubjectTokens, logger *zap.Logger) *TokenHandlers {
+func NewTokenHandlers(subjectTokens SubjectTokens, issuers func() []string, audiences func() []string, logger *zap.Logger) *TokenHandlers {
 	handlers := &TokenHandlers{}
 
 	if subjectTokens.OIDC != nil {
@@ -47,9 +54,40 @@ func NewTokenHandlers(subjectTokens SubjectTokens, logger *zap.Logger) *TokenHan
 		handlers.selfSignedTokenHandler = NewSelfSignedTokenHandler(subjectTokens.SelfSigned, logger)
 	}
 
+	if subjectTokens.TxnToken != nil {
+		handlers.txnTokenHandler = NewTxnTokenHandler(subjectTokens.TxnToken, issuers, audiences, logger)
+	}
+
 	return handlers
 }
 
+func (t *TokenHandlers) GetSupportedTokenTypes() []common.TokenType {
+	supportedTokenTypes := make([]common.TokenType, 0, 3)
+
+	if t.oIDCTokenHandler != nil {
+		supportedTokenTypes = append(supportedTokenTypes, common.OIDC_ID_TOKEN_TYPE)
+	}
+
+	if t.selfSignedTokenHandler != nil {
+		supportedTokenTypes = append(supportedTokenTypes, common.SELF_SIGNED_TOKEN_TYPE)
+	}
+
+	if t.txnTokenHandler != nil {
+		supportedTokenTypes = append(supportedTokenTypes, common.TXN_TOKEN_TYPE)
+	}
+
+	return supportedTokenTypes
+}
+
+func (t *TokenHandlers) CheckOIDCProvider(ctx context.Context) error {
+	oidcTokenHandler, ok := t.oIDCTokenHandler.(*OIDCTokenHandler)
+	if !ok {
+		return health.ErrNotConfigured
+	}
+
+	return oidcTokenHandler.CheckProvider(ctx)
+}
+
 func (t *TokenHandlers) GetHandler(tokenType common.TokenType) (TokenHandler, error) {
 	switch tokenType {
 	case common.OIDC_ID_TOKEN_TYPE:
@@ -57,15 +95,21 @@ func (t *TokenHandlers) GetHandler(tokenType common.TokenType) (TokenHandler, er
 			return t.oIDCTokenHandler, nil
 		}
 
-		return nil, errors.New("configuration not provided for OIDC subject token")
+		return nil, fmt.Errorf("%w: configuration not provided for OIDC subject token", tokeneteserrors.ErrUnsupportedTokenType)
 	case common.SELF_SIGNED_TOKEN_TYPE:
 		if t.selfSignedTokenHandler != nil {
 			return t.selfSignedTokenHandler, nil
 		}
 
-		return nil, errors.New("configuration not provided for self-signed subject token")
+		return nil, fmt.Errorf("%w: configuration not provided for self-signed subject token", tokeneteserrors.ErrUnsupportedTokenType)
+	case common.TXN_TOKEN_TYPE:
+		if t.txnTokenHandler != nil {
+			return t.txnTokenHandler, nil
+		}
+
+		return nil, fmt.Errorf("%w: configuration not provided for txn subject token", tokeneteserrors.ErrUnsupportedTokenType)
 
 	default:
-		return nil, fmt.Errorf("unsupported token type: %s", tokenType)
+		return nil, fmt.Errorf("%w: %s", tokeneteserrors.ErrUnsupportedTokenType, tokenType)
 	}
 }
@@ -0,0 +1,145 @@
+package subjecttokenhandler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/subjectidentifier"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"go.uber.org/zap"
+)
+
+const TXN_TOKEN_JWT_TYP = "txn_token"
+
+type TxnTokenHandler struct {
+	peerJWKS []*peerJWKS
+	// issuers and audiences return the issuers and audiences txn tokens are currently issued for, which include
+	// per-rule overrides.
+	issuers   func() []string
+	audiences func() []string
+	logger    *zap.Logger
+}
+
+func NewTxnTokenHandler(txnTokenConfig *TxnToken, issuers func() []string, audiences func() []string, logger *zap.Logger) *TxnTokenHandler {
+	peerJWKS := make([]*peerJWKS, 0, len(txnTokenConfig.PeerJWKSEndpoints))
+	for _, peerJWKSEndpoint := range txnTokenConfig.PeerJWKSEndpoints {
+		peerJWKS = append(peerJWKS, newPeerJWKS(peerJWKSEndpoint))
+	}
+
+	return &TxnTokenHandler{
+		peerJWKS:  peerJWKS,
+		issuers:   issuers,
+		audiences: audiences,
+		logger:    logger,
+	}
+}
+
+func (t *TxnTokenHandler) VerifyAndParse(ctx context.Context, token string) (interface{}, error) {
+	keyFunc := func(parsedToken *jwt.Token) (interface{}, error) {
+		if typ, ok := parsedToken.Header["typ"].(string); !ok || typ != TXN_TOKEN_JWT_TYP {
+			return nil, fmt.Errorf("token is not a txn token")
+		}
+
+		kid, ok := parsedToken.Header["kid"].(string)
+		if !ok {
+			return nil, fmt.Errorf("kid header not found in token")
+		}
+
+		key, err := t.lookupKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key.Algorithm() != parsedToken.Method.Alg() {
+			return nil, fmt.Errorf("token algorithm %s does not match key algorithm %s", parsedToken.Method.Alg(), key.Algorithm())
+		}
+
+		var publicKey interface{}
+		if err := key.Raw(&publicKey); err != nil {
+			return nil, fmt.Errorf("unable to get raw public key: %v", err)
+		}
+
+		return publicKey, nil
+	}
+
+	parsedToken, err := jwt.Parse(token, keyFunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error verifying txn token: %v", tokeneteserrors.ErrInvalidSubjectToken, err)
+	}
+
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, tokeneteserrors.ErrInvalidSubjectTokenClaims
+	}
+
+	if !t.verifyIssuer(claims) {
+		return nil, fmt.Errorf("%w: txn token issuer is not an issuer of this txn-token service", tokeneteserrors.ErrInvalidSubjectToken)
+	}
+
+	if !t.verifyAudience(claims) {
+		return nil, fmt.Errorf("%w: txn token audience is not issued by this txn-token service", tokeneteserrors.ErrInvalidSubjectToken)
+	}
+
+	if _, ok := claims["txn"].(string); !ok {
+		return nil, tokeneteserrors.ErrInvalidSubjectTokenClaims
+	}
+
+	return claims, nil
+}
+
+func (t *TxnTokenHandler) verifyIssuer(claims jwt.MapClaims) bool {
+	for _, issuer := range t.issuers() {
+		if claims.VerifyIssuer(issuer, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *TxnTokenHandler) verifyAudience(claims jwt.MapClaims) bool {
+	for _, audience := range t.audiences() {
+		if claims.VerifyAudience(audience, true) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *TxnTokenHandler) ExtractSubject(claims interface{}) (subjectidentifier.Identifier, error) {
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return nil, tokeneteserrors.ErrInvalidSubjectTokenClaims
+	}
+
+	subValue, ok := mapClaims["sub"]
+	if !ok {
+		return nil, tokeneteserrors.ErrSubjectFieldNotFound
+	}
+
+	return subValue, nil
+}
+
+// lookupKey checks this instance's key set first and only falls back to the cached peer instances' JWKS when the kid is unknown locally.
+func (t *TxnTokenHandler) lookupKey(ctx context.Context, kid string) (jwk.Key, error) {
+	if key, ok := keys.GetJWKS().LookupKeyID(kid); ok {
+		return key, nil
+	}
+
+	for _, peerJWKS := range t.peerJWKS {
+		key, ok, err := peerJWKS.lookupKey(ctx, kid)
+		if err != nil {
+			t.logger.Error("Failed to fetch peer JWKS.", zap.String("jwks-endpoint", peerJWKS.endpoint), zap.Error(err))
+		}
+
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unable to find key with kid %s", kid)
+}
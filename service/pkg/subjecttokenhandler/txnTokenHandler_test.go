@@ -0,0 +1,205 @@
+package subjecttokenhandler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/tokenetes/tokenetes/pkg/keys"
+	"github.com/tokenetes/tokenetes/pkg/tokeneteserrors"
+	"go.uber.org/zap"
+)
+
+const (
+	testIssuer = "https://tokenetes.example"
+	// testRuleIssuer is the issuer override of a trat generation rule.
+	testRuleIssuer = "https://payments.tokenetes.example"
+	testAudience   = "https://api.example"
+)
+
+func TestTxnTokenHandlerVerifyAndParse(t *testing.T) {
+	if err := keys.Initialize(keys.Config{}); err != nil {
+		t.Fatalf("failed to initialize keys: %v", err)
+	}
+
+	peerKey, peerJWKSServer := newPeerJWKSServer(t, "peer-kid")
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss": testIssuer,
+			"aud": testAudience,
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"txn": "txn-id",
+			"sub": "user",
+		}
+	}
+
+	localKid, localAlgorithm, localKey := keys.GetSigningKey()
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr error
+	}{
+		{
+			name: "valid token signed by this instance",
+			token: func() string {
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, validClaims())
+			},
+		},
+		{
+			name: "valid token signed by a peer instance",
+			token: func() string {
+				return signTestToken(t, jwt.SigningMethodRS256, "peer-kid", TXN_TOKEN_JWT_TYP, peerKey, validClaims())
+			},
+		},
+		{
+			name: "token with an unknown kid",
+			token: func() string {
+				return signTestToken(t, jwt.SigningMethodRS256, "unknown-kid", TXN_TOKEN_JWT_TYP, peerKey, validClaims())
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectToken,
+		},
+		{
+			name: "token that is not a txn token",
+			token: func() string {
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, "JWT", localKey, validClaims())
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectToken,
+		},
+		{
+			name: "valid token from a rule issuer override",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = testRuleIssuer
+
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, claims)
+			},
+		},
+		{
+			name: "token from another issuer",
+			token: func() string {
+				claims := validClaims()
+				claims["iss"] = "https://other.example"
+
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, claims)
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectToken,
+		},
+		{
+			name: "token for another audience",
+			token: func() string {
+				claims := validClaims()
+				claims["aud"] = "https://other.example"
+
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, claims)
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectToken,
+		},
+		{
+			name: "expired token",
+			token: func() string {
+				claims := validClaims()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, claims)
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectToken,
+		},
+		{
+			name: "token without a txn claim",
+			token: func() string {
+				claims := validClaims()
+				delete(claims, "txn")
+
+				return signTestToken(t, jwt.GetSigningMethod(localAlgorithm), localKid, TXN_TOKEN_JWT_TYP, localKey, claims)
+			},
+			wantErr: tokeneteserrors.ErrInvalidSubjectTokenClaims,
+		},
+	}
+
+	handler := NewTxnTokenHandler(&TxnToken{PeerJWKSEndpoints: []string{peerJWKSServer.URL}}, func() []string { return []string{testIssuer, testRuleIssuer} }, func() []string { return []string{testAudience} }, zap.NewNop())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := handler.VerifyAndParse(context.Background(), tt.token())
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("VerifyAndParse() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("VerifyAndParse() error = %v", err)
+			}
+
+			subject, err := handler.ExtractSubject(claims)
+			if err != nil || subject != "user" {
+				t.Fatalf("ExtractSubject() = %v, %v, want user", subject, err)
+			}
+		})
+	}
+}
+
+func newPeerJWKSServer(t *testing.T, kid string) (*rsa.PrivateKey, *httptest.Server) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	set := newTestKeySet(t, &privateKey.PublicKey, kid)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return privateKey, server
+}
+
+func newTestKeySet(t *testing.T, publicKey interface{}, kid string) jwk.Set {
+	t.Helper()
+
+	key, err := jwk.New(publicKey)
+	if err != nil {
+		t.Fatalf("failed to create JWK: %v", err)
+	}
+
+	key.Set(jwk.KeyIDKey, kid)
+	key.Set(jwk.AlgorithmKey, jwt.SigningMethodRS256.Alg())
+
+	set := jwk.NewSet()
+	set.Add(key)
+
+	return set
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, typ string, privateKey interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	token.Header["typ"] = typ
+
+	signed, err := token.SignedString(privateKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+
+	return signed
+}
@@ -2,14 +2,109 @@ package tokeneteserrors
 
 import (
 	"errors"
+	"net/http"
 )
 
-var ErrParsingSubjectToken = errors.New("error parsing subject token")
+type ErrorCode string
 
-var ErrInvalidSubjectTokenClaims = errors.New("invalid subject token claims")
+const (
+	InvalidRequest       ErrorCode = "invalid_request"
+	InvalidGrant         ErrorCode = "invalid_grant"
+	AccessDenied         ErrorCode = "access_denied"
+	UnsupportedGrantType ErrorCode = "unsupported_grant_type"
+	UnsupportedTokenType ErrorCode = "unsupported_token_type"
+	InvalidTarget        ErrorCode = "invalid_target"
+	ServerError          ErrorCode = "server_error"
+	// TemporarilyUnavailable is defined by RFC 6749 for authorization responses and is used here for dependencies
+	// that are down.
+	TemporarilyUnavailable ErrorCode = "temporarily_unavailable"
+)
+
+func (c ErrorCode) HTTPStatus() int {
+	switch c {
+	case AccessDenied:
+		return http.StatusForbidden
+	case ServerError:
+		return http.StatusInternalServerError
+	case TemporarilyUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// TokenetesError is a classified error. Errors returned while processing a txn-token request wrap one of the
+// sentinels below, so callers can use errors.Is for a specific failure and errors.As for its error code.
+type TokenetesError struct {
+	Code        ErrorCode
+	Description string
+	// wrapped is the sentinel a detailed error was made from.
+	wrapped error
+}
+
+func New(code ErrorCode, description string) *TokenetesError {
+	return &TokenetesError{
+		Code:        code,
+		Description: description,
+	}
+}
+
+func (e *TokenetesError) Error() string {
+	return e.Description
+}
+
+func (e *TokenetesError) Unwrap() error {
+	return e.wrapped
+}
+
+// WithDetail returns an error classified like e whose description ends with detail, e.g. the name of a missing
+// request field. detail is returned to the client, so it must not hold rule, policy or token details.
+func (e *TokenetesError) WithDetail(detail string) *TokenetesError {
+	return &TokenetesError{
+		Code:        e.Code,
+		Description: e.Description + ": " + detail,
+		wrapped:     e,
+	}
+}
+
+// Classify returns the error code and a client-safe description for err. The description is the one of the
+// classified error err wraps, with its detail if any, since the context wrapped around it may hold rule, policy or
+// upstream details that are only meant for the server logs. Unclassified errors are reported as server errors without exposing their
+// details.
+func Classify(err error) (ErrorCode, string) {
+	var tokenetesError *TokenetesError
+
+	if errors.As(err, &tokenetesError) {
+		return tokenetesError.Code, tokenetesError.Description
+	}
+
+	return ServerError, "internal server error"
+}
+
+var ErrInvalidRequest = New(InvalidRequest, "invalid txn-token request")
+
+var ErrUnsupportedGrantType = New(UnsupportedGrantType, "grant type not supported")
+
+var ErrParsingSubjectToken = New(InvalidGrant, "error parsing subject token")
+
+var ErrInvalidSubjectToken = New(InvalidGrant, "invalid subject token")
+
+var ErrInvalidSubjectTokenClaims = New(InvalidGrant, "invalid subject token claims")
+
+var ErrUnsupportedTokenType = New(UnsupportedTokenType, "token type not supported")
+
+var ErrSubjectFieldNotFound = New(InvalidGrant, "subject field not found in the subject token")
+
+var ErrInvalidAudience = New(InvalidTarget, "audience not supported by this txn-token service")
+
+var ErrNoMatchingRule = New(InvalidRequest, "no matching generation rule found")
+
+var ErrInvalidRequestDetails = New(InvalidRequest, "invalid request details")
+
+var ErrMissingRequiredAzdField = New(InvalidRequest, "required azd field missing from the request")
 
-var ErrUnsupportedTokenType = errors.New("token type not supported")
+var ErrAccessDenied = New(AccessDenied, "access denied for the request")
 
-var ErrSubjectFieldNotFound = errors.New("subject field not found in the subject token")
+var ErrReplacementScopeExpansion = New(AccessDenied, "replacement txn token cannot expand the purp or azd of the subject txn token")
 
-var ErrAccessDenied = errors.New("access denied for the request")
+var ErrAccessEvaluationUnavailable = New(TemporarilyUnavailable, "access evaluation api is unavailable")
@@ -0,0 +1,102 @@
+package tokeneteserrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		wantCode        ErrorCode
+		wantDescription string
+		wantStatus      int
+	}{
+		{
+			name:            "classified error",
+			err:             ErrAccessDenied,
+			wantCode:        AccessDenied,
+			wantDescription: "access denied for the request",
+			wantStatus:      http.StatusForbidden,
+		},
+		{
+			name:            "wrapped classified error keeps its details out of the description",
+			err:             fmt.Errorf("%w: error evaluating rule payments with token secret-value", ErrInvalidRequestDetails),
+			wantCode:        InvalidRequest,
+			wantDescription: "invalid request details",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "classified error wrapped several times",
+			err:             fmt.Errorf("error matching generation rule: %w", fmt.Errorf("%w: /a", ErrNoMatchingRule)),
+			wantCode:        InvalidRequest,
+			wantDescription: "no matching generation rule found",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "invalid subject token",
+			err:             fmt.Errorf("%w: error verifying txn token: signature is invalid", ErrInvalidSubjectToken),
+			wantCode:        InvalidGrant,
+			wantDescription: "invalid subject token",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "unavailable dependency",
+			err:             fmt.Errorf("%w: circuit breaker is open", ErrAccessEvaluationUnavailable),
+			wantCode:        TemporarilyUnavailable,
+			wantDescription: "access evaluation api is unavailable",
+			wantStatus:      http.StatusServiceUnavailable,
+		},
+		{
+			name:            "detail meant for the client is kept in the description",
+			err:             fmt.Errorf("%w: no value for azd field transfer_amount", ErrMissingRequiredAzdField.WithDetail("body.amount")),
+			wantCode:        InvalidRequest,
+			wantDescription: "required azd field missing from the request: body.amount",
+			wantStatus:      http.StatusBadRequest,
+		},
+		{
+			name:            "unclassified error",
+			err:             errors.New("failed to connect to 10.0.0.1:8181"),
+			wantCode:        ServerError,
+			wantDescription: "internal server error",
+			wantStatus:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, description := Classify(tt.err)
+
+			if code != tt.wantCode {
+				t.Errorf("Classify() code = %s, want %s", code, tt.wantCode)
+			}
+
+			if description != tt.wantDescription {
+				t.Errorf("Classify() description = %q, want %q", description, tt.wantDescription)
+			}
+
+			if status := code.HTTPStatus(); status != tt.wantStatus {
+				t.Errorf("HTTPStatus() = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWithDetail(t *testing.T) {
+	err := fmt.Errorf("%w: no value for azd field transfer_amount", ErrMissingRequiredAzdField.WithDetail("body.amount"))
+
+	if !errors.Is(err, ErrMissingRequiredAzdField) {
+		t.Errorf("errors.Is(%v, ErrMissingRequiredAzdField) = false, want true", err)
+	}
+
+	if errors.Is(err, ErrInvalidRequestDetails) {
+		t.Errorf("errors.Is(%v, ErrInvalidRequestDetails) = true, want false", err)
+	}
+
+	if description := ErrMissingRequiredAzdField.Description; description != "required azd field missing from the request" {
+		t.Errorf("sentinel description = %q, want it unchanged", description)
+	}
+}